@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	adapter_service "git.brobridge.com/gravity/gravity-adapter-mysql/pkg/adapter/service"
+	"github.com/spf13/viper"
+)
+
+// encryptPassword prints password encrypted by the same scheme which adapter
+// uses to decrypt it.
+func encryptPassword(args []string) error {
+
+	fs := flag.NewFlagSet("encrypt-password", flag.ExitOnError)
+	password := fs.String("password", "", "password to encrypt, read from stdin if not specified")
+	keyID := fs.String("key", "", "id of key to encrypt with, crypto.activeKey is used if not specified")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gravity-adapter-mysql encrypt-password [options]")
+		fmt.Fprintln(fs.Output(), "Keys are loaded from crypto.keys or crypto.keyFile of config.toml or environment variables.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	pwd := *password
+	if pwd == "" {
+		fmt.Fprint(os.Stderr, "Password: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return err
+		}
+
+		pwd = strings.TrimRight(line, "\r\n")
+	}
+
+	if pwd == "" {
+		return errors.New("Password is empty")
+	}
+
+	if *keyID != "" {
+		viper.Set("crypto.activeKey", *keyID)
+	}
+
+	encrypted, err := adapter_service.AesEncrypt(pwd)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(encrypted)
+
+	return nil
+}
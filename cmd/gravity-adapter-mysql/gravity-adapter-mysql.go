@@ -26,7 +26,8 @@ func init() {
 
 	log.SetLevel(debugLevel)
 
-	fmt.Printf("Debug level is set to \"%s\"\n", debugLevel.String())
+	// Keep stdout clean for output of subcommands
+	fmt.Fprintf(os.Stderr, "Debug level is set to \"%s\"\n", debugLevel.String())
 
 	// From the environment
 	viper.SetEnvPrefix("GRAVITY_ADAPTER_MYSQL")
@@ -66,6 +67,15 @@ func init() {
 
 func main() {
 
+	if len(os.Args) > 1 && os.Args[1] == "encrypt-password" {
+		err := encryptPassword(os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
 	// Initializing application
 	a := app.NewAppInstance()
 
@@ -45,9 +45,7 @@ func (adapter *Adapter) Init() error {
 	adapter.clientName = fmt.Sprintf("gravity_adapter_mysql-%s", host)
 
 	// Initializing store manager
-	viper.SetDefault("store.enabled", false)
-	enabled := viper.GetBool("store.enabled")
-	if enabled {
+	if checkpointStoreType() == CheckpointStoreBroton {
 		viper.SetDefault("store.path", "./store")
 		options := broton.NewOptions()
 		options.DatabasePath = viper.GetString("store.path")
@@ -73,5 +71,11 @@ func (adapter *Adapter) Init() error {
 }
 
 func (adapter *Adapter) Uninit() error {
-	return adapter.sm.Uninit()
+	err := adapter.sm.Uninit()
+
+	if adapter.storeMgr != nil {
+		adapter.storeMgr.Close()
+	}
+
+	return err
 }
@@ -4,8 +4,14 @@ import (
 	"fmt"
 	"strings"
 
+	"git.brobridge.com/gravity/gravity-adapter-mysql/pkg/adapter/service/parser"
 	"github.com/go-mysql-org/go-mysql/canal"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
 	"github.com/google/uuid"
+	tidb_parser "github.com/pingcap/tidb/pkg/parser"
+	"github.com/pingcap/tidb/pkg/parser/ast"
+	log "github.com/sirupsen/logrus"
 
 	"time"
 )
@@ -14,6 +20,29 @@ type binlogHandler struct {
 	canal.DummyEventHandler // Dummy handler from external lib
 	fn                      func(*CDCEvent)
 	canal                   *canal.Canal
+	database                *Database
+	dbName                  string
+	truncateOnDrop          bool
+	ddlParser               *tidb_parser.Parser
+	stmtParser              *parser.Parser
+	lastDDLPos              mysql.Position
+	intVars                 statementIntVars
+	syncedPos               mysql.Position // position of last transaction boundary
+}
+
+type tableNameCollector struct {
+	tables []*ast.TableName
+}
+
+func (v *tableNameCollector) Enter(n ast.Node) (ast.Node, bool) {
+	if table, ok := n.(*ast.TableName); ok {
+		v.tables = append(v.tables, table)
+	}
+	return n, false
+}
+
+func (v *tableNameCollector) Leave(n ast.Node) (ast.Node, bool) {
+	return n, true
 }
 
 func (h *binlogHandler) joinPKs(e *canal.RowsEvent, row []interface{}) string {
@@ -33,6 +62,12 @@ func (h *binlogHandler) joinPKs(e *canal.RowsEvent, row []interface{}) string {
 
 }
 
+// isWatched reports whether changes of table are published
+func (h *binlogHandler) isWatched(table string) bool {
+	_, ok := h.database.source.tables[table]
+	return ok
+}
+
 func (h *binlogHandler) convertValue(v interface{}) interface{} {
 	switch value := v.(type) {
 	case []byte:
@@ -44,8 +79,33 @@ func (h *binlogHandler) convertValue(v interface{}) interface{} {
 	}
 }
 
+func (h *binlogHandler) OnPosSynced(header *replication.EventHeader, pos mysql.Position, set mysql.GTIDSet, force bool) error {
+
+	var timestamp uint32
+	if header != nil {
+		timestamp = header.Timestamp
+	}
+
+	h.syncedPos = pos
+	h.database.updateProgress(pos, timestamp)
+
+	return nil
+}
+
+// eventID identifies a row by its location in binlog, so it is the same
+// when the event is read again after restart
+func (h *binlogHandler) eventID(logPos uint32, row int) string {
+	return fmt.Sprintf("%s-%d-%d", h.syncedPos.Name, logPos, row)
+}
+
 func (h *binlogHandler) OnRow(e *canal.RowsEvent) error {
 
+	// Changes of other tables must not move checkpoint, otherwise every
+	// checkpoint written by mysql checkpoint store causes another one
+	if e.Table.Schema != h.dbName || !h.isWatched(e.Table.Name) {
+		return nil
+	}
+
 	columns := []string{}
 	for _, column := range e.Table.Columns {
 		columns = append(columns, column.Name)
@@ -56,7 +116,10 @@ func (h *binlogHandler) OnRow(e *canal.RowsEvent) error {
 
 	for i, row := range e.Rows {
 
-		pos, _ := h.canal.GetMasterPos()
+		// Resuming from the last transaction boundary replays the whole
+		// transaction, events which were published already are dropped by
+		// server because they have the same message ID
+		pos := h.syncedPos
 		if e.Header == nil {
 			afterValue := make(map[string]interface{}, len(row))
 			result := cdcEventPool.Get().(*CDCEvent)
@@ -80,6 +143,7 @@ func (h *binlogHandler) OnRow(e *canal.RowsEvent) error {
 			result.PosName = pos.Name
 			result.Pos = pos.Pos
 			result.EventPKs = h.joinPKs(e, row)
+			result.EventID = ""
 			h.fn(result)
 
 			timer := time.NewTimer(50 * time.Microsecond)
@@ -112,6 +176,7 @@ func (h *binlogHandler) OnRow(e *canal.RowsEvent) error {
 			result.PosName = pos.Name
 			result.Pos = pos.Pos
 			result.EventPKs = h.joinPKs(e, row)
+			result.EventID = h.eventID(e.Header.LogPos, i)
 			h.fn(result)
 			break
 
@@ -133,6 +198,11 @@ func (h *binlogHandler) OnRow(e *canal.RowsEvent) error {
 				result.Operation = UpdateOperation
 				result.Table = e.Table.Name
 				result.Before = beforeValue
+
+				// Row is routed by key it had before, pipeline waits for
+				// other events before and after the update if primary key
+				// was changed, so events of either key stay in order
+				result.EventPKs = h.joinPKs(e, row)
 				updateEvent[updateKey] = result
 				continue
 			} else if i%2 != 0 {
@@ -153,9 +223,10 @@ func (h *binlogHandler) OnRow(e *canal.RowsEvent) error {
 				result.Operation = UpdateOperation
 				result.Table = e.Table.Name
 				result.After = afterValue
+				result.keyChanged = len(e.Table.PKColumns) > 0 && h.joinPKs(e, row) != result.EventPKs
 				result.PosName = pos.Name
 				result.Pos = pos.Pos
-				result.EventPKs = h.joinPKs(e, row)
+				result.EventID = h.eventID(e.Header.LogPos, i)
 				h.fn(result)
 				delete(updateEvent, updateKey)
 			}
@@ -185,6 +256,7 @@ func (h *binlogHandler) OnRow(e *canal.RowsEvent) error {
 			result.PosName = pos.Name
 			result.Pos = pos.Pos
 			result.EventPKs = h.joinPKs(e, row)
+			result.EventID = h.eventID(e.Header.LogPos, i)
 			h.fn(result)
 			break
 		}
@@ -193,3 +265,270 @@ func (h *binlogHandler) OnRow(e *canal.RowsEvent) error {
 
 	return nil
 }
+
+func (h *binlogHandler) OnDDL(header *replication.EventHeader, nextPos mysql.Position, queryEvent *replication.QueryEvent) error {
+
+	// canal calls OnDDL once per statement with the same query event
+	if nextPos.Compare(h.lastDDLPos) == 0 {
+		return nil
+	}
+	h.lastDDLPos = nextPos
+
+	if h.ddlParser == nil {
+		h.ddlParser = tidb_parser.New()
+	}
+
+	stmts, _, err := h.ddlParser.Parse(string(queryEvent.Query), "", "")
+	if err != nil {
+		log.Warn("Failed to parse query event: ", err)
+		return nil
+	}
+
+	for _, stmt := range stmts {
+		h.onDDLStatement(nextPos, string(queryEvent.Schema), stmt)
+	}
+
+	// DDL is a transaction boundary, reader of statement-based binlog does
+	// not have canal to report it
+	h.syncedPos = nextPos
+
+	return nil
+}
+
+// onDDLStatement publishes truncate events for statement which removes all
+// rows of watched tables
+func (h *binlogHandler) onDDLStatement(nextPos mysql.Position, defaultSchema string, stmt ast.StmtNode) {
+
+	tables := make([]*ast.TableName, 0)
+	switch s := stmt.(type) {
+	case *ast.TruncateTableStmt:
+		tables = append(tables, s.Table)
+	case *ast.DropTableStmt:
+		if !h.truncateOnDrop || s.IsView {
+			return
+		}
+		tables = append(tables, s.Tables...)
+	default:
+		return
+	}
+
+	for _, table := range tables {
+
+		schema := table.Schema.String()
+		if schema == "" {
+			schema = defaultSchema
+		}
+
+		if schema != h.dbName || !h.isWatched(table.Name.String()) {
+			continue
+		}
+
+		log.WithFields(log.Fields{
+			"table": table.Name.String(),
+			"query": stmt.Text(),
+		}).Info("Table was truncated")
+
+		result := cdcEventPool.Get().(*CDCEvent)
+		result.Operation = TruncateOperation
+		result.Table = table.Name.String()
+		result.After = nil
+		result.Before = nil
+
+		result.PosName = h.syncedPos.Name
+		result.Pos = h.syncedPos.Pos
+		result.EventPKs = fmt.Sprintf("truncate-%s-%d", nextPos.Name, nextPos.Pos)
+		result.EventID = fmt.Sprintf("truncate-%s-%d-%s", nextPos.Name, nextPos.Pos, result.Table)
+		h.fn(result)
+	}
+}
+
+// OnIntVar keeps INSERT_ID and LAST_INSERT_ID of the next query event
+func (h *binlogHandler) OnIntVar(e *replication.IntVarEvent) {
+
+	value := e.Value
+	switch e.Type {
+	case replication.INSERT_ID:
+		h.intVars.insertID = &value
+	case replication.LAST_INSERT_ID:
+		h.intVars.lastInsertID = &value
+	}
+}
+
+// OnQuery handles query events from binlogs in STATEMENT or MIXED format
+func (h *binlogHandler) OnQuery(header *replication.EventHeader, nextPos mysql.Position, queryEvent *replication.QueryEvent) error {
+
+	// Variables only apply to the query event which follows them
+	intVars := h.intVars
+	h.intVars = statementIntVars{}
+
+	query := string(queryEvent.Query)
+	switch strings.ToUpper(strings.TrimSpace(query)) {
+	case "COMMIT":
+		h.syncedPos = nextPos
+		return nil
+	case "BEGIN", "ROLLBACK":
+		return nil
+	}
+
+	if h.stmtParser == nil {
+		h.stmtParser = parser.NewParser()
+	}
+
+	// Statements are replayed with the timestamp of the original session
+	h.stmtParser.Timestamp = time.Unix(int64(header.Timestamp), 0)
+	h.stmtParser.LastInsertID = intVars.lastInsertID
+
+	stmts, err := h.stmtParser.ParseStatements(query)
+	if err != nil {
+		skippedStatementsCounter.WithLabelValues(h.database.source.name, "unsupported").Inc()
+		log.WithFields(log.Fields{
+			"query": query,
+			"pos":   nextPos.String(),
+		}).Error("Unsupported statement in binlog, skipped: ", err)
+		return nil
+	}
+
+	defaultSchema := string(queryEvent.Schema)
+	autoIncrement := newAutoIncrement(intVars.insertID, queryEvent.StatusVars)
+
+	// Statements of query are handled in order one by one, so DML is not
+	// lost because of other statements
+	ddl := false
+	index := 0
+	for _, stmt := range stmts {
+
+		if !stmt.DML {
+			ddl = true
+			h.clearTableCache(defaultSchema, stmt.Node)
+			h.onDDLStatement(nextPos, defaultSchema, stmt.Node)
+			continue
+		}
+
+		if stmt.Err != nil {
+			skippedStatementsCounter.WithLabelValues(h.database.source.name, "unsupported").Inc()
+			log.WithFields(log.Fields{
+				"query": stmt.Text,
+				"pos":   nextPos.String(),
+			}).Error("Unsupported statement in binlog, skipped: ", stmt.Err)
+			continue
+		}
+
+		for _, result := range stmt.Results {
+			h.onStatement(nextPos, index, defaultSchema, result, autoIncrement)
+			index++
+		}
+	}
+
+	// DDL is a transaction boundary
+	if ddl {
+		h.lastDDLPos = nextPos
+		h.syncedPos = nextPos
+	}
+
+	return nil
+}
+
+func (h *binlogHandler) clearTableCache(defaultSchema string, stmt ast.StmtNode) {
+
+	if _, ok := stmt.(ast.DDLNode); !ok {
+		return
+	}
+
+	collector := &tableNameCollector{}
+	stmt.Accept(collector)
+	for _, table := range collector.tables {
+		schema := table.Schema.String()
+		if schema == "" {
+			schema = defaultSchema
+		}
+
+		h.canal.ClearTableCache([]byte(schema), []byte(table.Name.String()))
+	}
+}
+
+func (h *binlogHandler) onStatement(pos mysql.Position, index int, defaultSchema string, result *parser.Result, autoIncrement *autoIncrement) {
+
+	schema := result.Schema
+	if schema == "" {
+		schema = defaultSchema
+	}
+
+	if schema != h.dbName || !h.isWatched(result.Table) {
+		return
+	}
+
+	table, err := h.canal.GetTable(schema, result.Table)
+	if err != nil {
+		skippedStatementsCounter.WithLabelValues(h.database.source.name, "table").Inc()
+		log.WithFields(log.Fields{
+			"table": result.Table,
+			"pos":   pos.String(),
+		}).Error("Failed to get table of statement in binlog, skipped: ", err)
+		return
+	}
+
+	if result.Operation == parser.InsertOperation {
+		err := autoIncrement.fill(table, result.AfterData)
+		if err != nil {
+			skippedStatementsCounter.WithLabelValues(h.database.source.name, "auto_increment").Inc()
+			log.WithFields(log.Fields{
+				"table": result.Table,
+				"pos":   pos.String(),
+			}).Error("Unsupported statement in binlog, skipped: ", err)
+			return
+		}
+	}
+
+	eventPKs, reason, err := statementKey(table, result)
+	if err != nil {
+		skippedStatementsCounter.WithLabelValues(h.database.source.name, reason).Inc()
+		log.WithFields(log.Fields{
+			"table": result.Table,
+			"pos":   pos.String(),
+		}).Error("Unsupported statement in binlog, skipped: ", err)
+		return
+	}
+
+	convert := func(data map[string]interface{}) map[string]interface{} {
+		if data == nil {
+			return nil
+		}
+
+		values := make(map[string]interface{}, len(data))
+		for k, v := range data {
+			values[k] = h.convertValue(v)
+		}
+
+		return values
+	}
+
+	cdcEvent := cdcEventPool.Get().(*CDCEvent)
+	switch result.Operation {
+	case parser.InsertOperation:
+		cdcEvent.Operation = InsertOperation
+	case parser.UpdateOperation:
+		cdcEvent.Operation = UpdateOperation
+	case parser.DeleteOperation:
+		cdcEvent.Operation = DeleteOperation
+	}
+
+	cdcEvent.Table = result.Table
+	cdcEvent.Before = convert(result.BeforeData)
+	cdcEvent.After = convert(result.AfterData)
+
+	// Values of columns which are not in statement are unknown
+	data := cdcEvent.After
+	if data == nil {
+		data = cdcEvent.Before
+	}
+	cdcEvent.Partial = len(data) < len(table.Columns)
+	cdcEvent.PosName = h.syncedPos.Name
+	cdcEvent.Pos = h.syncedPos.Pos
+	cdcEvent.EventPKs = eventPKs
+	cdcEvent.EventID = h.eventID(pos.Pos, index)
+	if result.Operation == parser.UpdateOperation {
+		newPKs, err := joinStatementPKs(table, result.AfterData)
+		cdcEvent.keyChanged = err != nil || newPKs != eventPKs
+	}
+	h.fn(cdcEvent)
+}
@@ -0,0 +1,131 @@
+package adapter
+
+import (
+	"errors"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	BinlogPurgedPolicyFail       = "fail"
+	BinlogPurgedPolicyEarliest   = "earliest"
+	BinlogPurgedPolicyResnapshot = "resnapshot"
+)
+
+var ErrBinlogPurged = errors.New("binlog has been purged from the server")
+
+type binaryLog struct {
+	Name string
+	Size uint64
+}
+
+func (database *Database) getBinaryLogs() ([]binaryLog, error) {
+
+	r, err := database.GetCanalConnection().Execute("SHOW BINARY LOGS")
+	if err != nil {
+		return nil, err
+	}
+
+	logs := make([]binaryLog, 0, r.RowNumber())
+	for i := 0; i < r.RowNumber(); i++ {
+		name, err := r.GetString(i, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		size, err := r.GetUint(i, 1)
+		if err != nil {
+			return nil, err
+		}
+
+		logs = append(logs, binaryLog{
+			Name: name,
+			Size: size,
+		})
+	}
+
+	return logs, nil
+}
+
+func (database *Database) isBinlogPurged(posName string) (bool, error) {
+
+	if posName == "" {
+		return false, nil
+	}
+
+	logs, err := database.getBinaryLogs()
+	if err != nil {
+		return false, err
+	}
+
+	for _, binlog := range logs {
+		if binlog.Name == posName {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// recoverPurgedBinlog moves the position according to the policy of source
+func (database *Database) recoverPurgedBinlog(tables []string, fn func(*CDCEvent)) error {
+
+	policy := database.source.info.BinlogPurgedPolicy
+	if policy == "" {
+		policy = BinlogPurgedPolicyFail
+	}
+
+	log.WithFields(log.Fields{
+		"source":  database.source.name,
+		"posName": database.lastPosName,
+		"pos":     database.lastPos,
+		"policy":  policy,
+	}).Error("Binlog has been purged from the server")
+
+	switch policy {
+	case BinlogPurgedPolicyEarliest:
+		logs, err := database.getBinaryLogs()
+		if err != nil {
+			return err
+		}
+
+		if len(logs) == 0 {
+			return ErrBinlogPurged
+		}
+
+		log.WithFields(log.Fields{
+			"source":  database.source.name,
+			"posName": logs[0].Name,
+		}).Warn("Resuming from the earliest binlog, changes in purged binlogs are lost")
+
+		database.lastPosName = logs[0].Name
+		database.lastPos = 4
+
+		return nil
+
+	case BinlogPurgedPolicyResnapshot:
+		// Changes made during the snapshot will be replayed from this position
+		pos, err := database.GetCanalConnection().GetMasterPos()
+		if err != nil {
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"source":  database.source.name,
+			"posName": pos.Name,
+			"pos":     pos.Pos,
+		}).Warn("Taking snapshot of tables again")
+
+		err = database.Resnapshot(tables, fn)
+		if err != nil {
+			return err
+		}
+
+		database.lastPosName = pos.Name
+		database.lastPos = pos.Pos
+
+		return nil
+	}
+
+	return ErrBinlogPurged
+}
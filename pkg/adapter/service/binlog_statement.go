@@ -0,0 +1,370 @@
+package adapter
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"git.brobridge.com/gravity/gravity-adapter-mysql/pkg/adapter/service/parser"
+	"github.com/go-mysql-org/go-mysql/canal"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
+	"github.com/google/uuid"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// canal only reports row events and DDL, so binlogs written in STATEMENT or
+// MIXED format are read with a plain binlog syncer instead.
+
+func (database *Database) getBinlogFormat() string {
+
+	r, err := database.GetCanalConnection().Execute("SELECT @@GLOBAL.binlog_format")
+	if err != nil {
+		log.Warn("Failed to get binlog format: ", err)
+		return "ROW"
+	}
+
+	format, err := r.GetString(0, 0)
+	if err != nil {
+		log.Warn("Failed to get binlog format: ", err)
+		return "ROW"
+	}
+
+	return strings.ToUpper(format)
+}
+
+func (database *Database) runStatementBinlog(pos mysql.Position, h *binlogHandler) error {
+
+	info := database.source.info
+	cfg := database.canalCfg
+
+	syncer := replication.NewBinlogSyncer(replication.BinlogSyncerConfig{
+		ServerID:                cfg.ServerID,
+		Flavor:                  cfg.Flavor,
+		Host:                    info.Host,
+		Port:                    uint16(info.Port),
+		User:                    cfg.User,
+		Password:                cfg.Password,
+		Charset:                 cfg.Charset,
+		HeartbeatPeriod:         cfg.HeartbeatPeriod,
+		ReadTimeout:             cfg.ReadTimeout,
+		UseDecimal:              cfg.UseDecimal,
+		ParseTime:               cfg.ParseTime,
+		TimestampStringLocation: cfg.TimestampStringLocation,
+		TLSConfig:               cfg.TLSConfig,
+		Logger:                  cfg.Logger,
+		Dialer:                  cfg.Dialer,
+	})
+	defer syncer.Close()
+
+	streamer, err := syncer.StartSync(pos)
+	if err != nil {
+		return err
+	}
+
+	ctx := database.GetCanalConnection().Ctx()
+	for {
+		ev, err := streamer.GetEvent(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return err
+		}
+
+		err = database.handleStatementBinlogEvent(h, &pos, ev)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (database *Database) handleStatementBinlogEvent(h *binlogHandler, pos *mysql.Position, ev *replication.BinlogEvent) error {
+
+	if ev.Header.LogPos > 0 {
+		pos.Pos = ev.Header.LogPos
+	}
+
+	defer func() {
+		database.updateProgress(*pos, ev.Header.Timestamp)
+	}()
+
+	switch e := ev.Event.(type) {
+	case *replication.RotateEvent:
+		pos.Name = string(e.NextLogName)
+		pos.Pos = uint32(e.Position)
+		return h.OnPosSynced(ev.Header, *pos, nil, true)
+	case *replication.XIDEvent:
+		return h.OnPosSynced(ev.Header, *pos, nil, false)
+	case *replication.TransactionPayloadEvent:
+		for _, subEvent := range e.Events {
+			err := database.handleStatementBinlogEvent(h, pos, subEvent)
+			if err != nil {
+				return err
+			}
+		}
+	case *replication.RowsEvent:
+		// MIXED format still writes row events for unsafe statements
+		if string(e.Table.Schema) != h.dbName {
+			return nil
+		}
+
+		table, err := database.GetCanalConnection().GetTable(string(e.Table.Schema), string(e.Table.Table))
+		if err != nil {
+			if err == schema.ErrTableNotExist || err == schema.ErrMissingTableMeta {
+				return nil
+			}
+
+			return err
+		}
+
+		var action string
+		switch ev.Header.EventType {
+		case replication.WRITE_ROWS_EVENTv1, replication.WRITE_ROWS_EVENTv2:
+			action = canal.InsertAction
+		case replication.UPDATE_ROWS_EVENTv1, replication.UPDATE_ROWS_EVENTv2:
+			action = canal.UpdateAction
+		case replication.DELETE_ROWS_EVENTv1, replication.DELETE_ROWS_EVENTv2:
+			action = canal.DeleteAction
+		default:
+			return nil
+		}
+
+		return h.OnRow(&canal.RowsEvent{
+			Table:  table,
+			Action: action,
+			Rows:   e.Rows,
+			Header: ev.Header,
+		})
+	case *replication.IntVarEvent:
+		h.OnIntVar(e)
+	case *replication.QueryEvent:
+		return h.OnQuery(ev.Header, *pos, e)
+	}
+
+	return nil
+}
+
+// statementIntVars are values of INTVAR_EVENT which come before a query event
+type statementIntVars struct {
+	insertID     *uint64
+	lastInsertID *uint64
+}
+
+// Codes of status variables of query event
+const (
+	statusFlags2        = 0
+	statusSQLMode       = 1
+	statusCatalog       = 2
+	statusAutoIncrement = 3
+	statusCatalogNZ     = 6
+
+	sqlModeNoAutoValueOnZero = 1 << 19
+)
+
+// autoIncrement generates values of AUTO_INCREMENT column which INSERT left to
+// server, the same way as server did from INSERT_ID recorded in binlog
+type autoIncrement struct {
+	next              uint64
+	valid             bool
+	increment         uint64
+	offset            uint64
+	noAutoValueOnZero bool
+}
+
+func newAutoIncrement(insertID *uint64, statusVars []byte) *autoIncrement {
+
+	a := &autoIncrement{
+		increment: 1,
+		offset:    1,
+	}
+
+	if insertID != nil {
+		a.next = *insertID
+		a.valid = true
+	}
+
+	a.parseStatusVars(statusVars)
+
+	return a
+}
+
+// parseStatusVars reads sql_mode and auto_increment_increment/offset of the
+// session. Server writes them before other variables, and auto increment
+// variables are only written if they are not 1.
+func (a *autoIncrement) parseStatusVars(data []byte) {
+
+	for i := 0; i < len(data); {
+
+		code := data[i]
+		i++
+
+		switch code {
+		case statusFlags2:
+			i += 4
+		case statusSQLMode:
+			if i+8 > len(data) {
+				return
+			}
+
+			a.noAutoValueOnZero = binary.LittleEndian.Uint64(data[i:])&sqlModeNoAutoValueOnZero != 0
+			i += 8
+		case statusCatalog:
+			if i >= len(data) {
+				return
+			}
+
+			i += 1 + int(data[i]) + 1
+		case statusCatalogNZ:
+			if i >= len(data) {
+				return
+			}
+
+			i += 1 + int(data[i])
+		case statusAutoIncrement:
+			if i+4 > len(data) {
+				return
+			}
+
+			a.increment = uint64(binary.LittleEndian.Uint16(data[i:]))
+			a.offset = uint64(binary.LittleEndian.Uint16(data[i+2:]))
+			if a.increment == 0 {
+				a.increment = 1
+			}
+
+			return
+		default:
+			return
+		}
+	}
+}
+
+// after returns the first value which server generates after n
+func (a *autoIncrement) after(n uint64) uint64 {
+
+	// Server ignores offset which is larger than increment
+	offset := a.offset
+	if offset > a.increment {
+		offset = 1
+	}
+
+	if n < offset {
+		return offset
+	}
+
+	return (n-offset)/a.increment*a.increment + a.increment + offset
+}
+
+// fill sets value of AUTO_INCREMENT column of inserted row if it was
+// generated by server
+func (a *autoIncrement) fill(table *schema.Table, data map[string]interface{}) error {
+
+	for _, column := range table.Columns {
+
+		if !column.IsAuto {
+			continue
+		}
+
+		v, ok := data[column.Name]
+		if ok && v != nil {
+			n, isNumber := autoIncrementValue(v)
+			if !isNumber || n != 0 || a.noAutoValueOnZero {
+				// Explicit value moves the counter forward
+				if isNumber && a.valid && n >= a.next {
+					a.next = a.after(n)
+				}
+
+				return nil
+			}
+		}
+
+		if !a.valid {
+			return fmt.Errorf("value of AUTO_INCREMENT column %s was not recorded in binlog", column.Name)
+		}
+
+		if column.IsUnsigned {
+			data[column.Name] = a.next
+		} else {
+			data[column.Name] = int64(a.next)
+		}
+
+		a.next += a.increment
+
+		return nil
+	}
+
+	return nil
+}
+
+func autoIncrementValue(v interface{}) (uint64, bool) {
+
+	switch n := v.(type) {
+	case int64:
+		if n < 0 {
+			return 0, false
+		}
+
+		return uint64(n), true
+	case uint64:
+		return n, true
+	case string:
+		u, err := strconv.ParseUint(n, 10, 64)
+		return u, err == nil
+	}
+
+	return 0, false
+}
+
+// statementKey returns primary key of the row which statement changes, and
+// reason of skipping statement if it fails. UPDATE and DELETE must compare
+// exactly the primary key in WHERE, other conditions may match no row at all.
+func statementKey(table *schema.Table, result *parser.Result) (string, string, error) {
+
+	// Rows are identified by their primary key in the statement itself,
+	// updates by the key before they were changed
+	keyData := result.BeforeData
+	if result.Operation == parser.InsertOperation {
+		keyData = result.AfterData
+	}
+
+	if len(table.PKColumns) == 0 {
+		if result.Operation != parser.InsertOperation {
+			return "", "primary_key", errors.New("table without primary key")
+		}
+
+		return uuid.New().String(), "", nil
+	}
+
+	if result.Operation != parser.InsertOperation && len(keyData) != len(table.PKColumns) {
+		return "", "where", errors.New("WHERE must only compare primary key")
+	}
+
+	key, err := joinStatementPKs(table, keyData)
+	if err != nil {
+		return "", "primary_key", err
+	}
+
+	return key, "", nil
+}
+
+// joinStatementPKs joins values of primary key the same way as joinPKs
+func joinStatementPKs(table *schema.Table, data map[string]interface{}) (string, error) {
+
+	pks := make([]string, len(table.PKColumns))
+	for i, idx := range table.PKColumns {
+		column := table.Columns[idx].Name
+		v, ok := data[column]
+		if !ok {
+			return "", fmt.Errorf("primary key %s is not specified", column)
+		}
+
+		pks[i] = fmt.Sprintf("%v", v)
+	}
+
+	return strings.Join(pks, "-"), nil
+}
@@ -0,0 +1,191 @@
+package adapter
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"git.brobridge.com/gravity/gravity-adapter-mysql/pkg/adapter/service/parser"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+func testTable() *schema.Table {
+	return &schema.Table{
+		Schema: "test",
+		Name:   "accounts",
+		Columns: []schema.TableColumn{
+			{Name: "id", IsAuto: true},
+			{Name: "name"},
+			{Name: "status"},
+		},
+		PKColumns: []int{0},
+	}
+}
+
+func autoIncrementStatusVars(increment uint16, offset uint16, sqlMode uint64) []byte {
+
+	data := []byte{statusFlags2, 0, 0, 0, 0, statusSQLMode}
+	data = binary.LittleEndian.AppendUint64(data, sqlMode)
+	data = append(data, statusCatalogNZ, 3, 'd', 'e', 'f')
+
+	if increment != 1 || offset != 1 {
+		data = append(data, statusAutoIncrement)
+		data = binary.LittleEndian.AppendUint16(data, increment)
+		data = binary.LittleEndian.AppendUint16(data, offset)
+	}
+
+	// Charset
+	return append(data, 4, 33, 0, 33, 0, 8, 0)
+}
+
+func TestAutoIncrementFill(t *testing.T) {
+
+	insertID := uint64(100)
+
+	tests := []struct {
+		name       string
+		insertID   *uint64
+		statusVars []byte
+		rows       []map[string]interface{}
+		want       []interface{}
+		err        bool
+	}{
+		{
+			name:     "generated",
+			insertID: &insertID,
+			rows:     []map[string]interface{}{{"name": "fred"}, {"name": "wilma"}},
+			want:     []interface{}{int64(100), int64(101)},
+		},
+		{
+			name:     "null and zero",
+			insertID: &insertID,
+			rows:     []map[string]interface{}{{"id": nil}, {"id": int64(0)}},
+			want:     []interface{}{int64(100), int64(101)},
+		},
+		{
+			name:       "zero with NO_AUTO_VALUE_ON_ZERO",
+			insertID:   &insertID,
+			statusVars: autoIncrementStatusVars(1, 1, sqlModeNoAutoValueOnZero),
+			rows:       []map[string]interface{}{{"id": int64(0)}, {}},
+			want:       []interface{}{int64(0), int64(100)},
+		},
+		{
+			name:       "increment and offset",
+			insertID:   &insertID,
+			statusVars: autoIncrementStatusVars(10, 3, 0),
+			rows:       []map[string]interface{}{{}, {}, {"id": int64(500)}, {}},
+			want:       []interface{}{int64(100), int64(110), int64(500), int64(503)},
+		},
+		{
+			name:     "explicit value moves counter",
+			insertID: &insertID,
+			rows:     []map[string]interface{}{{}, {"id": int64(200)}, {}, {"id": int64(50)}, {}},
+			want:     []interface{}{int64(100), int64(200), int64(201), int64(50), int64(202)},
+		},
+		{
+			name: "explicit without insert id",
+			rows: []map[string]interface{}{{"id": int64(7)}},
+			want: []interface{}{int64(7)},
+		},
+		{
+			name: "generated without insert id",
+			rows: []map[string]interface{}{{"name": "fred"}},
+			err:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			a := newAutoIncrement(tt.insertID, tt.statusVars)
+			table := testTable()
+
+			got := make([]interface{}, 0, len(tt.rows))
+			for _, row := range tt.rows {
+				err := a.fill(table, row)
+				if err != nil {
+					if !tt.err {
+						t.Fatal(err)
+					}
+					return
+				}
+
+				got = append(got, row["id"])
+			}
+
+			if tt.err {
+				t.Fatal("fill succeeded, want error")
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("ids %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatementKey(t *testing.T) {
+
+	table := testTable()
+	noPK := testTable()
+	noPK.PKColumns = nil
+
+	tests := []struct {
+		name   string
+		table  *schema.Table
+		result *parser.Result
+		key    string
+		reason string
+	}{
+		{
+			name:   "insert",
+			table:  table,
+			result: &parser.Result{Operation: parser.InsertOperation, AfterData: map[string]interface{}{"id": int64(1), "name": "fred"}},
+			key:    "1",
+		},
+		{
+			name:   "update by primary key",
+			table:  table,
+			result: &parser.Result{Operation: parser.UpdateOperation, BeforeData: map[string]interface{}{"id": int64(1)}, AfterData: map[string]interface{}{"id": int64(2)}},
+			key:    "1",
+		},
+		{
+			name:   "update with extra condition",
+			table:  table,
+			result: &parser.Result{Operation: parser.UpdateOperation, BeforeData: map[string]interface{}{"id": int64(1), "status": "x"}},
+			reason: "where",
+		},
+		{
+			name:   "delete without primary key",
+			table:  table,
+			result: &parser.Result{Operation: parser.DeleteOperation, BeforeData: map[string]interface{}{"name": "fred"}},
+			reason: "primary_key",
+		},
+		{
+			name:   "delete from table without primary key",
+			table:  noPK,
+			result: &parser.Result{Operation: parser.DeleteOperation, BeforeData: map[string]interface{}{"name": "fred"}},
+			reason: "primary_key",
+		},
+		{
+			name:   "insert without primary key value",
+			table:  table,
+			result: &parser.Result{Operation: parser.InsertOperation, AfterData: map[string]interface{}{"name": "fred"}},
+			reason: "primary_key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			key, reason, err := statementKey(tt.table, tt.result)
+			if (err != nil) != (tt.reason != "") || reason != tt.reason {
+				t.Fatalf("statementKey() = %q, %q, %v, want reason %q", key, reason, err, tt.reason)
+			}
+
+			if tt.reason == "" && key != tt.key {
+				t.Fatalf("key = %q, want %q", key, tt.key)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package adapter
+
+import (
+	"errors"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const (
+	DefaultReconnectInterval    = 1
+	DefaultReconnectMaxInterval = 60
+	DefaultReconnectMaxRetries  = 0
+)
+
+const (
+	BinlogReaderStarting = "starting"
+	BinlogReaderRunning  = "running"
+	BinlogReaderBackoff  = "backoff"
+	BinlogReaderPaused   = "paused"
+	BinlogReaderFailed   = "failed"
+	BinlogReaderStopped  = "stopped"
+)
+
+type BinlogReaderStatus struct {
+	State         string    `json:"state"`
+	Restarts      int       `json:"restarts"`
+	LastError     string    `json:"lastError,omitempty"`
+	LastErrorTime time.Time `json:"lastErrorTime,omitempty"`
+	NextRetryTime time.Time `json:"nextRetryTime,omitempty"`
+}
+
+func (database *Database) GetReaderStatus() BinlogReaderStatus {
+	database.statusMu.RLock()
+	defer database.statusMu.RUnlock()
+	return database.readerStatus
+}
+
+func (database *Database) setReaderState(state string) {
+	database.statusMu.Lock()
+	defer database.statusMu.Unlock()
+	database.readerStatus.State = state
+}
+
+func (database *Database) setReaderError(state string, err error, nextRetry time.Time) {
+	database.statusMu.Lock()
+	defer database.statusMu.Unlock()
+	database.readerStatus.State = state
+	database.readerStatus.LastError = err.Error()
+	database.readerStatus.LastErrorTime = time.Now()
+	database.readerStatus.NextRetryTime = nextRetry
+}
+
+// superviseEvents keeps the binlog reader running and restarts it from the
+// last checkpoint with exponential backoff when it stops unexpectedly.
+func (database *Database) superviseEvents(tables []string, initialLoad bool, fn func(*CDCEvent)) {
+
+	viper.SetDefault("source.reconnectInterval", DefaultReconnectInterval)
+	viper.SetDefault("source.reconnectMaxInterval", DefaultReconnectMaxInterval)
+	viper.SetDefault("source.reconnectMaxRetries", DefaultReconnectMaxRetries)
+	interval := time.Duration(viper.GetInt64("source.reconnectInterval")) * time.Second
+	maxInterval := time.Duration(viper.GetInt64("source.reconnectMaxInterval")) * time.Second
+	maxRetries := viper.GetInt("source.reconnectMaxRetries")
+
+	attempts := 0
+	for {
+		if database.isPaused() {
+			database.setReaderState(BinlogReaderPaused)
+			if !database.waitResume() {
+				database.setReaderState(BinlogReaderStopped)
+				return
+			}
+
+			database.restartReader()
+			attempts = 0
+			continue
+		}
+
+		database.setReaderState(BinlogReaderRunning)
+		startTime := time.Now()
+
+		err := database.WatchEvents(tables, initialLoad, fn)
+		if database.stopping.Load() {
+			database.setReaderState(BinlogReaderStopped)
+			return
+		}
+
+		if database.isPaused() {
+			continue
+		}
+
+		if err == ErrBinlogPurged {
+			database.setReaderError(BinlogReaderFailed, err, time.Time{})
+			log.Fatal(err)
+		}
+
+		if err == nil {
+			err = errors.New("binlog reader stopped unexpectedly")
+		}
+
+		// The retry budget only counts failures which happen in a row
+		if time.Since(startTime) > maxInterval {
+			attempts = 0
+		}
+
+		attempts++
+		if maxRetries > 0 && attempts > maxRetries {
+			database.setReaderError(BinlogReaderFailed, err, time.Time{})
+			log.WithFields(log.Fields{
+				"source":   database.source.name,
+				"attempts": attempts - 1,
+			}).Error("Binlog reader gave up reconnecting: ", err)
+			return
+		}
+
+		delay := backoffDelay(attempts, interval, maxInterval)
+		database.setReaderError(BinlogReaderBackoff, err, time.Now().Add(delay))
+
+		log.WithFields(log.Fields{
+			"source":  database.source.name,
+			"attempt": attempts,
+			"delay":   delay,
+		}).Warn("Binlog reader stopped, reconnecting: ", err)
+
+		time.Sleep(delay)
+		if database.stopping.Load() {
+			database.setReaderState(BinlogReaderStopped)
+			return
+		}
+
+		database.restartReader()
+	}
+}
+
+func (database *Database) restartReader() {
+
+	database.statusMu.Lock()
+	database.readerStatus.State = BinlogReaderStarting
+	database.readerStatus.Restarts++
+	database.statusMu.Unlock()
+
+	err := database.resetCanal()
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	// Resume from the last position which was published
+	posName, pos := database.source.getCheckpoint()
+	if posName != "" {
+		database.lastPosName = posName
+		database.lastPos = pos
+	}
+}
+
+// waitReaderState returns false if reader did not reach state in time
+func (database *Database) waitReaderState(state string, timeout time.Duration) bool {
+
+	deadline := time.Now().Add(timeout)
+	for database.GetReaderStatus().State != state {
+		if time.Now().After(deadline) {
+			return false
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return true
+}
+
+func (database *Database) isPaused() bool {
+	return atomic.LoadInt32(&database.paused) == 1
+}
+
+// Pause stops reading binlog until Resume is called
+func (database *Database) Pause() {
+
+	if !atomic.CompareAndSwapInt32(&database.paused, 0, 1) {
+		return
+	}
+
+	database.GetCanalConnection().Close()
+}
+
+func (database *Database) Resume() {
+
+	if !atomic.CompareAndSwapInt32(&database.paused, 1, 0) {
+		return
+	}
+
+	select {
+	case database.resumeCh <- struct{}{}:
+	default:
+	}
+}
+
+func (database *Database) waitResume() bool {
+
+	for database.isPaused() {
+		if database.stopping.Load() {
+			return false
+		}
+
+		select {
+		case <-database.resumeCh:
+		case <-time.After(time.Second):
+		}
+	}
+
+	return !database.stopping.Load()
+}
+
+// backoffDelay returns an exponential delay with jitter between 50% and 100%
+func backoffDelay(attempts int, interval time.Duration, maxInterval time.Duration) time.Duration {
+
+	delay := interval
+	for i := 1; i < attempts && delay < maxInterval; i++ {
+		delay *= 2
+	}
+
+	if delay > maxInterval {
+		delay = maxInterval
+	}
+
+	half := int64(delay / 2)
+	if half <= 0 {
+		return delay
+	}
+
+	return time.Duration(half + rand.Int63n(half))
+}
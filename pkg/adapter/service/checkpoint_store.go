@@ -0,0 +1,159 @@
+package adapter
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/BrobridgeOrg/broton"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const (
+	CheckpointStoreNone      = "none"
+	CheckpointStoreBroton    = "broton"
+	CheckpointStoreJetStream = "jetstream"
+	CheckpointStoreMySQL     = "mysql"
+	CheckpointStoreFile      = "file"
+
+	// DefaultCheckpointFlushInterval is how often checkpoint is written to
+	// store in seconds
+	DefaultCheckpointFlushInterval = 1
+)
+
+// CheckpointStore keeps binlog position and initial load status of a source,
+// so it resumes from where it stopped after restart
+type CheckpointStore interface {
+	GetPosition() (string, uint32, error)
+	PutPosition(posName string, pos uint32) error
+	GetInitialLoaded(table string) (bool, error)
+	PutInitialLoaded(table string, loaded bool) error
+	Close() error
+}
+
+// checkpointStoreType returns backend of checkpoint store, broton is used by
+// default if store was enabled
+func checkpointStoreType() string {
+
+	viper.SetDefault("store.enabled", false)
+	if viper.GetBool("store.enabled") {
+		viper.SetDefault("checkpoint.type", CheckpointStoreBroton)
+	} else {
+		viper.SetDefault("checkpoint.type", CheckpointStoreNone)
+	}
+
+	return viper.GetString("checkpoint.type")
+}
+
+// newCheckpointStore returns nil if checkpoints are not persisted
+func newCheckpointStore(source *Source) (CheckpointStore, error) {
+
+	storeType := checkpointStoreType()
+
+	log.WithFields(log.Fields{
+		"source": source.name,
+		"type":   storeType,
+	}).Info("Initializing checkpoint store")
+
+	switch storeType {
+	case "", CheckpointStoreNone:
+		return nil, nil
+	case CheckpointStoreBroton:
+		return newBrotonCheckpointStore(source)
+	case CheckpointStoreJetStream:
+		return newJetStreamCheckpointStore(source)
+	case CheckpointStoreMySQL:
+		return newMySQLCheckpointStore(source)
+	case CheckpointStoreFile:
+		return newFileCheckpointStore(source)
+	}
+
+	return nil, fmt.Errorf("Unknown checkpoint store \"%s\"", storeType)
+}
+
+// brotonCheckpointStore keeps checkpoints in local store of adapter
+type brotonCheckpointStore struct {
+	name  string
+	store *broton.Store
+	mu    sync.Mutex
+}
+
+func newBrotonCheckpointStore(source *Source) (CheckpointStore, error) {
+
+	if source.adapter.storeMgr == nil {
+		return nil, fmt.Errorf("Store was not initialized")
+	}
+
+	store, err := source.adapter.storeMgr.GetStore("adapter-" + source.name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Register columns
+	err = store.RegisterColumns([]string{"status"})
+	if err != nil {
+		return nil, err
+	}
+
+	return &brotonCheckpointStore{
+		name:  source.name,
+		store: store,
+	}, nil
+}
+
+func (s *brotonCheckpointStore) GetPosition() (string, uint32, error) {
+
+	posName, err := s.store.GetString("status", []byte(s.name+"-POSNAME"))
+	if err != nil {
+		return "", 0, err
+	}
+
+	pos, err := s.store.GetUint64("status", []byte(s.name+"-POS"))
+	if err != nil {
+		return "", 0, err
+	}
+
+	return posName, uint32(pos), nil
+}
+
+func (s *brotonCheckpointStore) PutPosition(posName string, pos uint32) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.store.PutUint64("status", []byte(s.name+"-POS"), uint64(pos))
+	if err != nil {
+		return fmt.Errorf("Failed to update Position: %v", err)
+	}
+
+	err = s.store.PutString("status", []byte(s.name+"-POSNAME"), posName)
+	if err != nil {
+		return fmt.Errorf("Failed to update Position Name: %v", err)
+	}
+
+	return nil
+}
+
+func (s *brotonCheckpointStore) GetInitialLoaded(table string) (bool, error) {
+
+	status, err := s.store.GetInt64("status", []byte(fmt.Sprintf("%s-%s-initialload", s.name, table)))
+	if err != nil {
+		return false, err
+	}
+
+	return status != 0, nil
+}
+
+func (s *brotonCheckpointStore) PutInitialLoaded(table string, loaded bool) error {
+
+	var status int64
+	if loaded {
+		status = 1
+	}
+
+	return s.store.PutInt64("status", []byte(fmt.Sprintf("%s-%s-initialload", s.name, table)), status)
+}
+
+func (s *brotonCheckpointStore) Close() error {
+	return nil
+}
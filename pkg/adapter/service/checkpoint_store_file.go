@@ -0,0 +1,137 @@
+package adapter
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	DefaultCheckpointPath = "./checkpoints"
+)
+
+type fileCheckpoint struct {
+	PosName     string          `json:"posName"`
+	Pos         uint32          `json:"pos"`
+	InitialLoad map[string]bool `json:"initialLoad"`
+}
+
+// fileCheckpointStore keeps checkpoint of source in a JSON file, it is
+// replaced at once so a crash never leaves a partial file
+type fileCheckpointStore struct {
+	filename   string
+	mu         sync.Mutex
+	checkpoint fileCheckpoint
+}
+
+func newFileCheckpointStore(source *Source) (CheckpointStore, error) {
+
+	viper.SetDefault("checkpoint.path", DefaultCheckpointPath)
+	path := viper.GetString("checkpoint.path")
+
+	err := os.MkdirAll(path, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &fileCheckpointStore{
+		filename: filepath.Join(path, source.name+".json"),
+		checkpoint: fileCheckpoint{
+			InitialLoad: make(map[string]bool),
+		},
+	}
+
+	data, err := os.ReadFile(s.filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &s.checkpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.checkpoint.InitialLoad == nil {
+		s.checkpoint.InitialLoad = make(map[string]bool)
+	}
+
+	return s, nil
+}
+
+func (s *fileCheckpointStore) save() error {
+
+	data, err := json.MarshalIndent(&s.checkpoint, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.filename + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, s.filename)
+}
+
+func (s *fileCheckpointStore) GetPosition() (string, uint32, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.checkpoint.PosName, s.checkpoint.Pos, nil
+}
+
+func (s *fileCheckpointStore) PutPosition(posName string, pos uint32) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.checkpoint.PosName = posName
+	s.checkpoint.Pos = pos
+
+	return s.save()
+}
+
+func (s *fileCheckpointStore) GetInitialLoaded(table string) (bool, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.checkpoint.InitialLoad[table], nil
+}
+
+func (s *fileCheckpointStore) PutInitialLoaded(table string, loaded bool) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.checkpoint.InitialLoad[table] = loaded
+
+	return s.save()
+}
+
+func (s *fileCheckpointStore) Close() error {
+	return nil
+}
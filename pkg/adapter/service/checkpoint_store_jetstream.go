@@ -0,0 +1,145 @@
+package adapter
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+	"github.com/spf13/viper"
+)
+
+const (
+	DefaultCheckpointBucket = "gravity_checkpoints"
+)
+
+type jetStreamPosition struct {
+	PosName string `json:"posName"`
+	Pos     uint32 `json:"pos"`
+}
+
+// jetStreamCheckpointStore keeps checkpoints in a key-value bucket of
+// JetStream, so no persistent volume is required
+type jetStreamCheckpointStore struct {
+	name string
+	kv   nats.KeyValue
+}
+
+func newJetStreamCheckpointStore(source *Source) (CheckpointStore, error) {
+
+	viper.SetDefault("checkpoint.bucket", DefaultCheckpointBucket)
+	bucket := viper.GetString("checkpoint.bucket")
+
+	js, err := source.adapter.app.GetConnection().JetStream()
+	if err != nil {
+		return nil, err
+	}
+
+	kv, err := js.KeyValue(bucket)
+	if errors.Is(err, nats.ErrBucketNotFound) {
+		kv, err = js.CreateKeyValue(&nats.KeyValueConfig{
+			Bucket:      bucket,
+			Description: "Checkpoints of gravity-adapter-mysql",
+			History:     1,
+		})
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &jetStreamCheckpointStore{
+		name: source.name,
+		kv:   kv,
+	}, nil
+}
+
+// key joins encoded parts with name of source, names of source and table may
+// contain characters which are not allowed or have a meaning in keys of bucket
+func (s *jetStreamCheckpointStore) key(parts ...string) string {
+
+	tokens := make([]string, 0, len(parts)+1)
+	tokens = append(tokens, encodeKeyToken(s.name))
+	for _, part := range parts {
+		tokens = append(tokens, encodeKeyToken(part))
+	}
+
+	return strings.Join(tokens, ".")
+}
+
+// encodeKeyToken escapes bytes other than letters, digits, "-" and "_" as
+// "=XX", so names which only have those characters keep their keys
+func encodeKeyToken(name string) string {
+
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "=%02X", c)
+		}
+	}
+
+	return b.String()
+}
+
+func (s *jetStreamCheckpointStore) GetPosition() (string, uint32, error) {
+
+	entry, err := s.kv.Get(s.key("position"))
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		return "", 0, nil
+	}
+
+	if err != nil {
+		return "", 0, err
+	}
+
+	var position jetStreamPosition
+	err = json.Unmarshal(entry.Value(), &position)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return position.PosName, position.Pos, nil
+}
+
+func (s *jetStreamCheckpointStore) PutPosition(posName string, pos uint32) error {
+
+	data, err := json.Marshal(&jetStreamPosition{
+		PosName: posName,
+		Pos:     pos,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = s.kv.Put(s.key("position"), data)
+
+	return err
+}
+
+func (s *jetStreamCheckpointStore) GetInitialLoaded(table string) (bool, error) {
+
+	entry, err := s.kv.Get(s.key("initialload", table))
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return strconv.ParseBool(string(entry.Value()))
+}
+
+func (s *jetStreamCheckpointStore) PutInitialLoaded(table string, loaded bool) error {
+	_, err := s.kv.Put(s.key("initialload", table), []byte(strconv.FormatBool(loaded)))
+	return err
+}
+
+func (s *jetStreamCheckpointStore) Close() error {
+	return nil
+}
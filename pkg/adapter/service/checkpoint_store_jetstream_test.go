@@ -0,0 +1,30 @@
+package adapter
+
+import "testing"
+
+func TestJetStreamCheckpointKey(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		source string
+		parts  []string
+		want   string
+	}{
+		{"plain names", "mysql_source-1", []string{"initialload", "accounts"}, "mysql_source-1.initialload.accounts"},
+		{"position", "mysql", []string{"position"}, "mysql.position"},
+		{"dot in table", "mysql", []string{"initialload", "a.b"}, "mysql.initialload.a=2Eb"},
+		{"wildcards", "my*", []string{"initialload", ">"}, "my=2A.initialload.=3E"},
+		{"escape character", "a=b", []string{"position"}, "a=3Db.position"},
+		{"slash and space", "db/main", []string{"initialload", "t 1"}, "db=2Fmain.initialload.t=201"},
+		{"utf-8", "來源", []string{"position"}, "=E4=BE=86=E6=BA=90.position"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &jetStreamCheckpointStore{name: tt.source}
+			if got := s.key(tt.parts...); got != tt.want {
+				t.Fatalf("key = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package adapter
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	initMysql "github.com/go-sql-driver/mysql"
+	"github.com/spf13/viper"
+)
+
+const (
+	DefaultCheckpointTable = "gravity_checkpoint"
+)
+
+var tableNameRe = regexp.MustCompile(`^[a-zA-Z0-9_$]+$`)
+
+// mysqlCheckpointStore keeps checkpoints in a table of the source database,
+// it requires privileges to create and write the table
+type mysqlCheckpointStore struct {
+	name  string
+	table string
+	db    *sql.DB
+}
+
+func newMySQLCheckpointStore(source *Source) (CheckpointStore, error) {
+
+	viper.SetDefault("checkpoint.table", DefaultCheckpointTable)
+	table := viper.GetString("checkpoint.table")
+	if !tableNameRe.MatchString(table) {
+		return nil, fmt.Errorf("Invalid checkpoint table name \"%s\"", table)
+	}
+
+	config, err := newMySQLConfig(source.info)
+	if err != nil {
+		return nil, err
+	}
+
+	connector, err := initMysql.NewConnector(config)
+	if err != nil {
+		return nil, err
+	}
+
+	db := sql.OpenDB(connector)
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS `%s` ("+
+		"`source` VARCHAR(191) NOT NULL, "+
+		"`name` VARCHAR(191) NOT NULL, "+
+		"`value` VARCHAR(255) NOT NULL, "+
+		"`updated_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP, "+
+		"PRIMARY KEY (`source`, `name`))", table))
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &mysqlCheckpointStore{
+		name:  source.name,
+		table: table,
+		db:    db,
+	}, nil
+}
+
+// get returns empty string if name does not exist
+func (s *mysqlCheckpointStore) get(name string) (string, error) {
+
+	var value string
+	err := s.db.QueryRow(fmt.Sprintf("SELECT `value` FROM `%s` WHERE `source` = ? AND `name` = ?", s.table), s.name, name).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+
+	return value, err
+}
+
+func (s *mysqlCheckpointStore) GetPosition() (string, uint32, error) {
+
+	posName, err := s.get("posName")
+	if err != nil {
+		return "", 0, err
+	}
+
+	value, err := s.get("pos")
+	if err != nil || value == "" {
+		return posName, 0, err
+	}
+
+	pos, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return posName, uint32(pos), nil
+}
+
+func (s *mysqlCheckpointStore) PutPosition(posName string, pos uint32) error {
+
+	// Both values are changed at once
+	_, err := s.db.Exec(fmt.Sprintf("INSERT INTO `%s` (`source`, `name`, `value`) VALUES (?, 'posName', ?), (?, 'pos', ?) "+
+		"ON DUPLICATE KEY UPDATE `value` = VALUES(`value`)", s.table), s.name, posName, s.name, strconv.FormatUint(uint64(pos), 10))
+
+	return err
+}
+
+func (s *mysqlCheckpointStore) GetInitialLoaded(table string) (bool, error) {
+
+	value, err := s.get("initialload:" + table)
+	if err != nil || value == "" {
+		return false, err
+	}
+
+	return strconv.ParseBool(value)
+}
+
+func (s *mysqlCheckpointStore) PutInitialLoaded(table string, loaded bool) error {
+
+	_, err := s.db.Exec(fmt.Sprintf("INSERT INTO `%s` (`source`, `name`, `value`) VALUES (?, ?, ?) "+
+		"ON DUPLICATE KEY UPDATE `value` = VALUES(`value`)", s.table), s.name, "initialload:"+table, strconv.FormatBool(loaded))
+
+	return err
+}
+
+func (s *mysqlCheckpointStore) Close() error {
+	return s.db.Close()
+}
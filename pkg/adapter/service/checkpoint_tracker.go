@@ -0,0 +1,106 @@
+package adapter
+
+import (
+	"sync"
+)
+
+type trackedEvent struct {
+	posName    string
+	pos        uint32
+	generation uint64
+	checkpoint bool
+	done       bool
+}
+
+// checkpointTracker moves checkpoint in binlog order while events are
+// published by partitions in any order. Events are numbered when they enter
+// the pipeline, and checkpoint only moves to an event after all events before
+// it were done.
+type checkpointTracker struct {
+	source *Source
+	mu     sync.Mutex
+	base   uint64
+	events []trackedEvent
+
+	// committed is sequence of the last committed checkpoint, commits may be
+	// done by different goroutines
+	commitMu  sync.Mutex
+	committed uint64
+}
+
+func newCheckpointTracker(source *Source) *checkpointTracker {
+	return &checkpointTracker{
+		source: source,
+		base:   1,
+		events: make([]trackedEvent, 0),
+	}
+}
+
+// add returns sequence number of event
+func (t *checkpointTracker) add(event *CDCEvent) uint64 {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.events = append(t.events, trackedEvent{
+		posName:    event.PosName,
+		pos:        event.Pos,
+		generation: event.generation,
+		checkpoint: event.Operation != SnapshotOperation,
+	})
+
+	return t.base + uint64(len(t.events)) - 1
+}
+
+// done marks event as published, acknowledged or given up
+func (t *checkpointTracker) done(seq uint64) {
+
+	t.mu.Lock()
+
+	if seq < t.base || seq-t.base >= uint64(len(t.events)) {
+		t.mu.Unlock()
+		return
+	}
+
+	t.events[seq-t.base].done = true
+
+	// Find the last checkpoint of which all events before were done
+	var last *trackedEvent
+	var lastSeq uint64
+	n := 0
+	for n < len(t.events) && t.events[n].done {
+		if t.events[n].checkpoint {
+			e := t.events[n]
+			last = &e
+			lastSeq = t.base + uint64(n)
+		}
+		n++
+	}
+
+	t.events = t.events[n:]
+	t.base += uint64(n)
+	t.mu.Unlock()
+
+	if last == nil {
+		return
+	}
+
+	t.commitMu.Lock()
+	defer t.commitMu.Unlock()
+
+	if lastSeq <= t.committed {
+		return
+	}
+
+	t.source.commitCheckpoint(last.posName, last.pos, last.generation)
+	t.committed = lastSeq
+}
+
+// Len returns number of events which are not done yet
+func (t *checkpointTracker) Len() int {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return len(t.events)
+}
@@ -0,0 +1,299 @@
+package adapter
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// recordingStore keeps every position which was put
+type recordingStore struct {
+	mu        sync.Mutex
+	positions []uint32
+}
+
+func (s *recordingStore) GetPosition() (string, uint32, error) {
+	return "", 0, nil
+}
+
+func (s *recordingStore) PutPosition(posName string, pos uint32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.positions = append(s.positions, pos)
+	return nil
+}
+
+func (s *recordingStore) GetInitialLoaded(table string) (bool, error) {
+	return false, nil
+}
+
+func (s *recordingStore) PutInitialLoaded(table string, loaded bool) error {
+	return nil
+}
+
+func (s *recordingStore) Close() error {
+	return nil
+}
+
+func (s *recordingStore) committed() []uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]uint32(nil), s.positions...)
+}
+
+func newTestSource() (*Source, *recordingStore) {
+
+	store := &recordingStore{}
+	source := &Source{
+		name:        "test",
+		checkpoints: store,
+		done:        make(chan struct{}),
+	}
+
+	source.tracker = newCheckpointTracker(source)
+
+	return source, store
+}
+
+func TestCheckpointTracker(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		operations []OperationType
+		done       []uint64
+		want       []uint32
+		pending    int
+	}{
+		{
+			name:       "in order",
+			operations: []OperationType{InsertOperation, UpdateOperation, DeleteOperation},
+			done:       []uint64{1, 2, 3},
+			want:       []uint32{10, 20, 30},
+		},
+		{
+			name:       "out of order",
+			operations: []OperationType{InsertOperation, InsertOperation, InsertOperation},
+			done:       []uint64{3, 1, 2},
+			want:       []uint32{10, 30},
+		},
+		{
+			name:       "waiting for the first event",
+			operations: []OperationType{InsertOperation, InsertOperation, InsertOperation},
+			done:       []uint64{2, 3},
+			want:       nil,
+			pending:    3,
+		},
+		{
+			name:       "snapshot is not checkpoint",
+			operations: []OperationType{InsertOperation, SnapshotOperation, InsertOperation},
+			done:       []uint64{2, 1, 3},
+			want:       []uint32{10, 30},
+		},
+		{
+			name:       "duplicated and unknown events",
+			operations: []OperationType{InsertOperation, InsertOperation},
+			done:       []uint64{1, 1, 5, 0},
+			want:       []uint32{10},
+			pending:    1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, store := newTestSource()
+
+			for i, op := range tt.operations {
+				seq := source.tracker.add(&CDCEvent{
+					Operation: op,
+					PosName:   "mysql-bin.000001",
+					Pos:       uint32(i+1) * 10,
+				})
+
+				if seq != uint64(i+1) {
+					t.Fatalf("sequence = %d, want %d", seq, i+1)
+				}
+			}
+
+			for _, seq := range tt.done {
+				source.tracker.done(seq)
+				if err := source.flushCheckpoint(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got := store.committed()
+			if len(got) != len(tt.want) {
+				t.Fatalf("committed %v, want %v", got, tt.want)
+			}
+
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("committed %v, want %v", got, tt.want)
+				}
+			}
+
+			if n := source.tracker.Len(); n != tt.pending {
+				t.Fatalf("pending = %d, want %d", n, tt.pending)
+			}
+		})
+	}
+}
+
+// Partitions finish events in any order and at the same time, checkpoint must
+// never move backwards
+func TestCheckpointTrackerMonotonic(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		events  int
+		workers int
+	}{
+		{"single worker", 1000, 1},
+		{"four workers", 1000, 4},
+		{"many workers", 5000, 32},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, store := newTestSource()
+
+			seqs := make([]uint64, tt.events)
+			for i := range seqs {
+				seqs[i] = source.tracker.add(&CDCEvent{
+					Operation: InsertOperation,
+					PosName:   "mysql-bin.000001",
+					Pos:       uint32(i + 1),
+				})
+			}
+
+			rand.Shuffle(len(seqs), func(i, j int) {
+				seqs[i], seqs[j] = seqs[j], seqs[i]
+			})
+
+			// Checkpoint is written while workers still move it
+			stop := make(chan struct{})
+			flushed := make(chan struct{})
+			go func() {
+				defer close(flushed)
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+						source.flushCheckpoint()
+					}
+				}
+			}()
+
+			var wg sync.WaitGroup
+			for w := 0; w < tt.workers; w++ {
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+					for i := w; i < len(seqs); i += tt.workers {
+						source.tracker.done(seqs[i])
+					}
+				}(w)
+			}
+			wg.Wait()
+			close(stop)
+			<-flushed
+
+			if err := source.flushCheckpoint(); err != nil {
+				t.Fatal(err)
+			}
+
+			got := store.committed()
+			for i := 1; i < len(got); i++ {
+				if got[i] <= got[i-1] {
+					t.Fatalf("checkpoint moved from %d to %d", got[i-1], got[i])
+				}
+			}
+
+			if len(got) == 0 || got[len(got)-1] != uint32(tt.events) {
+				t.Fatalf("last checkpoint %v, want %d", got, tt.events)
+			}
+
+			if _, pos := source.getCheckpoint(); pos != uint32(tt.events) {
+				t.Fatalf("checkpoint = %d, want %d", pos, tt.events)
+			}
+		})
+	}
+}
+
+// Acknowledgements of events which were read before checkpoint was reset must
+// not overwrite it
+func TestCheckpointTrackerGeneration(t *testing.T) {
+
+	tests := []struct {
+		name string
+		// events are read before reset, the rest after
+		before int
+		after  int
+		done   []uint64
+		want   []uint32
+	}{
+		{"old events only", 2, 0, []uint64{1, 2}, nil},
+		{"old events done first", 2, 2, []uint64{1, 2, 3, 4}, []uint32{1003, 1004}},
+		{"new events wait for old ones", 2, 2, []uint64{3, 4, 2, 1}, []uint32{1004}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, store := newTestSource()
+
+			push := func(pos uint32) {
+				event := &CDCEvent{
+					Operation: InsertOperation,
+					PosName:   "mysql-bin.000001",
+					Pos:       pos,
+				}
+
+				event.generation = source.checkpointGeneration()
+				source.tracker.add(event)
+			}
+
+			for i := 1; i <= tt.before; i++ {
+				push(uint32(i))
+			}
+
+			// What ResetCheckpoint does once binlog reader was stopped
+			source.checkpointMu.Lock()
+			source.checkpointGen++
+			source.lastPosName = "mysql-bin.000001"
+			source.lastPos = 1000
+			source.checkpointMu.Unlock()
+
+			for i := 1; i <= tt.after; i++ {
+				push(uint32(1000 + tt.before + i))
+			}
+
+			for _, seq := range tt.done {
+				source.tracker.done(seq)
+				if err := source.flushCheckpoint(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got := store.committed()
+			if len(got) != len(tt.want) {
+				t.Fatalf("committed %v, want %v", got, tt.want)
+			}
+
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("committed %v, want %v", got, tt.want)
+				}
+			}
+
+			want := uint32(1000)
+			if len(tt.want) > 0 {
+				want = tt.want[len(tt.want)-1]
+			}
+
+			if _, pos := source.getCheckpoint(); pos != want {
+				t.Fatalf("checkpoint = %d, want %d", pos, want)
+			}
+		})
+	}
+}
@@ -1,8 +1,10 @@
 package adapter
 
 import (
+	"database/sql"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-mysql-org/go-mysql/canal"
@@ -29,14 +31,28 @@ type DatabaseInfo struct {
 	DbName   string `json:"db_name"`
 }
 type Database struct {
-	source      *Source
-	dbInfo      *DatabaseInfo
-	tableInfo   map[string]tableInfo
-	canal       *canal.Canal
-	db          *sqlx.DB
-	lastPosName string
-	lastPos     uint32
-	stopping    bool
+	source        *Source
+	dbInfo        *DatabaseInfo
+	tableInfoMu   sync.RWMutex
+	tableInfo     map[string]tableInfo
+	canalMu       sync.RWMutex
+	canal         *canal.Canal
+	canalCfg      *canal.Config
+	db            *sqlx.DB
+	mysqlConfig   *initMysql.Config
+	lastPosName   string
+	lastPos       uint32
+	stopping      atomic.Bool
+	statusMu      sync.RWMutex
+	readerStatus  BinlogReaderStatus
+	progressMu    sync.RWMutex
+	readPos       mysql.Position
+	lastEventTime time.Time
+	lag           ReplicationLag
+	snapshotting  int32
+	snapshotMu    sync.Mutex
+	paused        int32
+	resumeCh      chan struct{}
 }
 type tableInfo struct {
 	initialLoaded bool
@@ -46,7 +62,10 @@ func NewDatabase() *Database {
 	return &Database{
 		dbInfo:    &DatabaseInfo{},
 		tableInfo: make(map[string]tableInfo, 0),
-		stopping:  false,
+		resumeCh:  make(chan struct{}, 1),
+		readerStatus: BinlogReaderStatus{
+			State: BinlogReaderStarting,
+		},
 	}
 }
 
@@ -58,6 +77,7 @@ func (database *Database) Connect(source *Source) error {
 		"port":     info.Port,
 		"username": info.Username,
 		"dbname":   info.DBName,
+		"tls":      info.TLS.Mode,
 	}).Info("Connecting to database")
 
 	targetTables := make([]string, 0, len(info.Tables))
@@ -86,33 +106,59 @@ func (database *Database) Connect(source *Source) error {
 	cfg.Dump.TableDB = info.DBName
 	cfg.Dump.Tables = targetTables
 
-	// Open cannal
-	c, err := canal.NewCanal(cfg)
+	// Open database
+	config, err := newMySQLConfig(info)
+	if err != nil {
+		return err
+	}
+	config.Loc = loc
+
+	database.mysqlConfig = config
+	err = database.openDB()
 	if err != nil {
 		log.Fatal(err)
 		return nil
 	}
-	database.canal = c
 
-	// Open database
-	config := initMysql.Config{
-		User:                 info.Username,
-		Passwd:               info.Password,
-		Addr:                 connStr,
-		Net:                  "tcp",
-		DBName:               info.DBName,
-		AllowNativePasswords: true,
-		Loc:                  loc,
-		ParseTime:            true,
-		//Params:               params,
+	// canal always requires TLS if it was configured
+	cfg.TLSConfig = config.TLS
+	if info.TLS.Mode == TLSModePreferred {
+		encrypted, err := isTLSConnection(database.db)
+		if err != nil {
+			log.Warn("Failed to check TLS connection: ", err)
+		} else if !encrypted {
+			log.WithFields(log.Fields{
+				"host": info.Host,
+			}).Warn("Server does not support TLS, connecting without encryption")
+			cfg.TLSConfig = nil
+		}
 	}
 
-	initConnStr := config.FormatDSN()
-	db, err := sqlx.Open("mysql", initConnStr)
+	// Open cannal
+	c, err := canal.NewCanal(cfg)
 	if err != nil {
 		log.Fatal(err)
 		return nil
 	}
+	database.canalMu.Lock()
+	database.canal = c
+	database.canalMu.Unlock()
+	database.canalCfg = cfg
+
+	database.source = source
+
+	return nil
+}
+
+func (database *Database) openDB() error {
+
+	// Connector keeps TLS config which can not be put in DSN
+	connector, err := initMysql.NewConnector(database.mysqlConfig)
+	if err != nil {
+		return err
+	}
+
+	db := sqlx.NewDb(sql.OpenDB(connector), "mysql")
 
 	db.SetMaxOpenConns(5)
 	db.SetMaxIdleConns(5)
@@ -121,32 +167,107 @@ func (database *Database) Connect(source *Source) error {
 
 	database.db = db
 
-	database.source = source
-
 	return nil
 }
 
 func (database *Database) Uninit() {
-	database.stopping = true
-	database.canal.Close()
+	database.stopping.Store(true)
+	database.GetCanalConnection().Close()
+}
+
+func (database *Database) Ping() error {
+	_, err := database.GetCanalConnection().Execute("SELECT 1")
+	return err
 }
 
 func (database *Database) GetCanalConnection() *canal.Canal {
+	database.canalMu.RLock()
+	defer database.canalMu.RUnlock()
 	return database.canal
 }
 
+func (database *Database) getTableInfo(tableName string) tableInfo {
+	database.tableInfoMu.RLock()
+	defer database.tableInfoMu.RUnlock()
+	return database.tableInfo[tableName]
+}
+
+func (database *Database) setTableInfo(tableName string, info tableInfo) {
+	database.tableInfoMu.Lock()
+	defer database.tableInfoMu.Unlock()
+	database.tableInfo[tableName] = info
+}
+
+// refreshCredentials takes credentials from secret providers again because
+// they might be rotated
+func (database *Database) refreshCredentials() error {
+
+	info := *database.source.info
+	err := resolveCredentials(database.source.name, &info)
+	if err != nil {
+		return err
+	}
+
+	database.canalCfg.User = info.Username
+	database.canalCfg.Password = info.Password
+
+	config, err := newMySQLConfig(&info)
+	if err != nil {
+		return err
+	}
+	config.Loc = database.canalCfg.TimestampStringLocation
+	database.mysqlConfig = config
+
+	// Certificates might be renewed as well
+	if database.canalCfg.TLSConfig != nil {
+		database.canalCfg.TLSConfig = config.TLS
+	}
+
+	return nil
+}
+
+// resetCanal replaces the canal which can not be started again once it stopped
+func (database *Database) resetCanal() error {
+
+	err := database.refreshCredentials()
+	if err != nil {
+		log.Warn("Failed to refresh credentials: ", err)
+	}
+
+	c, err := canal.NewCanal(database.canalCfg)
+	if err != nil {
+		return err
+	}
+
+	database.canalMu.Lock()
+	old := database.canal
+	database.canal = c
+	database.canalMu.Unlock()
+
+	old.Close()
+
+	return nil
+}
+
 func (database *Database) WatchEvents(tables []string, initialLoad bool, fn func(*CDCEvent)) error {
 
-	c := database.GetCanalConnection()
 	for {
-		if database.stopping {
+		if database.stopping.Load() {
 			time.Sleep(time.Second)
 			return nil
 		}
+
+		if database.isPaused() {
+			return nil
+		}
 		log.Info("Start Watch Event.")
+		c := database.GetCanalConnection()
 		h := &binlogHandler{
-			fn:    fn,
-			canal: c,
+			fn:             fn,
+			canal:          c,
+			database:       database,
+			dbName:         database.source.info.DBName,
+			truncateOnDrop: database.source.info.TruncateOnDrop,
 		}
 		c.SetEventHandler(h)
 		//if !initialLoad && database.lastPos == 0 {
@@ -159,32 +280,72 @@ func (database *Database) WatchEvents(tables []string, initialLoad bool, fn func
 			Name: database.lastPosName,
 			Pos:  database.lastPos,
 		}
+		h.syncedPos = pos
+
+		// Make sure the binlog we are resuming from still exists
+		purged, err := database.isBinlogPurged(pos.Name)
+		if err != nil {
+			log.Warn("Failed to check binary logs: ", err)
+		} else if purged {
+			err = database.recoverPurgedBinlog(tables, fn)
+			if err != nil {
+				return err
+			}
+			continue
+		}
 
-		err := c.RunFrom(pos)
+		format := database.getBinlogFormat()
+		if format == "ROW" {
+			err = c.RunFrom(pos)
+		} else {
+			log.WithFields(log.Fields{
+				"format": format,
+			}).Info("Reading statement-based binlog")
+			err = database.runStatementBinlog(pos, h)
+		}
 		if err != nil {
-			if database.stopping {
+			if database.stopping.Load() || database.isPaused() {
 				return nil
 			}
 
+			// The binlog might be purged while we were disconnected
+			if purged, _ := database.isBinlogPurged(database.lastPosName); purged {
+				err = database.resetCanal()
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
 			log.Error(err)
 			<-time.After(1 * time.Second)
 			return err
 		}
 	}
-
-	return nil
 }
 
 func (database *Database) DoInitialLoad(sourceName string, tables []string, fn func(*CDCEvent)) error {
+
+	atomic.AddInt32(&database.snapshotting, 1)
+	defer atomic.AddInt32(&database.snapshotting, -1)
+
 	for _, tableName := range tables {
 		//get tableInfo
-		tableInfo := database.tableInfo[tableName]
+		tableInfo := database.getTableInfo(tableName)
 
 		// if scn not equal 0 than don't do it.
 		if tableInfo.initialLoaded {
 			continue
 		}
 
+		snapshotInProgressGauge.WithLabelValues(sourceName, tableName).Set(1)
+
+		pkColumns := database.getPKColumns(tableName)
+
+		// Rows of another snapshot of the same table must not be dropped by
+		// server as duplicates
+		generation := time.Now().UnixNano()
+
 		i := uint32(0)
 		// query
 		// begin transation
@@ -214,17 +375,20 @@ func (database *Database) DoInitialLoad(sourceName string, tables []string, fn f
 			}
 
 			i += 1
+			snapshotRowsCounter.WithLabelValues(sourceName, tableName).Inc()
 			//Prepare CDC event
 			e := database.processSnapshotEvent(tableName, event)
 			e.PosName = tableName
 			e.Pos = i
+			e.EventPKs = joinSnapshotPKs(pkColumns, e.After)
+			e.EventID = fmt.Sprintf("%d-%d", generation, i)
 
 			fn(e)
 			eventPool.Put(event)
 
 		}
 		if err := rows.Err(); err != nil {
-			if database.stopping {
+			if database.stopping.Load() {
 				return nil
 			}
 			log.Error("Initialization Error: ", err)
@@ -235,11 +399,17 @@ func (database *Database) DoInitialLoad(sourceName string, tables []string, fn f
 
 		tx.Commit()
 
-		initialLoadStatusCol := fmt.Sprintf("%s-%s-initialload", sourceName, tableName)
-		err = database.source.store.PutInt64("status", []byte(initialLoadStatusCol), 1)
-		if err != nil {
-			log.Error(err)
-			return err
+		snapshotInProgressGauge.WithLabelValues(sourceName, tableName).Set(0)
+
+		tableInfo.initialLoaded = true
+		database.setTableInfo(tableName, tableInfo)
+
+		if database.source.checkpoints != nil {
+			err = database.source.checkpoints.PutInitialLoaded(tableName, true)
+			if err != nil {
+				log.Error(err)
+				return err
+			}
 		}
 		log.Info(tableName, " initialLoad done.")
 
@@ -255,7 +425,63 @@ func (database *Database) StartCDC(tables []string, initialLoad bool, fn func(*C
 	}
 	database.db.Close()
 
-	go database.WatchEvents(tables, initialLoad, fn)
+	go database.superviseEvents(tables, initialLoad, fn)
+	go database.monitorLag()
 
 	return nil
 }
+
+func newMySQLConfig(info *SourceInfo) (*initMysql.Config, error) {
+
+	config := initMysql.NewConfig()
+	config.User = info.Username
+	config.Passwd = info.Password
+	config.Addr = fmt.Sprintf("%s:%d", info.Host, info.Port)
+	config.Net = "tcp"
+	config.DBName = info.DBName
+	config.AllowNativePasswords = true
+	config.ParseTime = true
+
+	tlsConfig, err := info.newTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	config.TLS = tlsConfig
+	config.AllowFallbackToPlaintext = info.TLS.Mode == TLSModePreferred
+
+	return config, nil
+}
+
+// Resnapshot loads existing records of tables again with a new connection
+func (database *Database) Resnapshot(tables []string, fn func(*CDCEvent)) error {
+
+	database.snapshotMu.Lock()
+	defer database.snapshotMu.Unlock()
+
+	for _, tableName := range tables {
+		database.setTableInfo(tableName, tableInfo{
+			initialLoaded: false,
+		})
+
+		if database.source.checkpoints != nil {
+			err := database.source.checkpoints.PutInitialLoaded(tableName, false)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err := database.refreshCredentials()
+	if err != nil {
+		log.Warn("Failed to refresh credentials: ", err)
+	}
+
+	err = database.openDB()
+	if err != nil {
+		return err
+	}
+	defer database.db.Close()
+
+	return database.DoInitialLoad(database.source.name, tables, fn)
+}
@@ -0,0 +1,252 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const (
+	DeadLetterNone    = "none"
+	DeadLetterSubject = "subject"
+	DeadLetterFile    = "file"
+)
+
+const (
+	DefaultDeadLetterPath = "./deadletter"
+)
+
+// DeadLetter is a record of event which could not be published
+type DeadLetter struct {
+	Source      string              `json:"source"`
+	Table       string              `json:"table"`
+	EventName   string              `json:"eventName"`
+	MsgID       string              `json:"msgId"`
+	PosName     string              `json:"posName,omitempty"`
+	Pos         uint32              `json:"pos,omitempty"`
+	Error       string              `json:"error"`
+	Permanent   bool                `json:"permanent"`
+	Retries     int                 `json:"retries"`
+	Time        time.Time           `json:"time"`
+	PayloadSize int                 `json:"payloadSize"`
+	Payload     jsoniter.RawMessage `json:"payload,omitempty"`
+}
+
+// deadLetterQueue takes events out of replication when they were rejected by
+// server, or failed more times than allowed
+type deadLetterQueue struct {
+	source     *Source
+	kind       string
+	subject    string
+	path       string
+	maxRetries int
+	mu         sync.Mutex
+	file       *os.File
+}
+
+func newDeadLetterQueue(source *Source) *deadLetterQueue {
+
+	viper.SetDefault("deadLetter.type", DeadLetterNone)
+	viper.SetDefault("deadLetter.subject", fmt.Sprintf("$GVT.%s.DLQ.%s", viper.GetString("gravity.domain"), source.name))
+	viper.SetDefault("deadLetter.path", DefaultDeadLetterPath)
+	viper.SetDefault("deadLetter.maxRetries", 0)
+
+	return &deadLetterQueue{
+		source:     source,
+		kind:       viper.GetString("deadLetter.type"),
+		subject:    viper.GetString("deadLetter.subject"),
+		path:       viper.GetString("deadLetter.path"),
+		maxRetries: viper.GetInt("deadLetter.maxRetries"),
+	}
+}
+
+// isPermanentError reports whether publishing fails the same way no matter
+// how many times it was retried
+func isPermanentError(err error) bool {
+
+	switch {
+	case errors.Is(err, nats.ErrMaxPayload),
+		errors.Is(err, nats.ErrBadSubject),
+		errors.Is(err, nats.ErrBadHeaderMsg):
+		return true
+	}
+
+	// Server rejected the message itself, e.g. it exceeds maximum message
+	// size of stream
+	var apiErr *nats.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == 400
+	}
+
+	return false
+}
+
+// isTransientError reports whether publishing failed because server was not
+// reachable or not available, rather than because of the message itself
+func isTransientError(err error) bool {
+
+	switch {
+	case errors.Is(err, nats.ErrConnectionClosed),
+		errors.Is(err, nats.ErrConnectionDraining),
+		errors.Is(err, nats.ErrConnectionReconnecting),
+		errors.Is(err, nats.ErrDisconnected),
+		errors.Is(err, nats.ErrNoServers),
+		errors.Is(err, nats.ErrStaleConnection),
+		errors.Is(err, nats.ErrTimeout),
+		errors.Is(err, nats.ErrNoResponders),
+		errors.Is(err, nats.ErrNoStreamResponse),
+		errors.Is(err, nats.ErrJetStreamNotEnabled),
+		errors.Is(err, nats.ErrJetStreamPublisherClosed),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, context.Canceled):
+		return true
+	}
+
+	// Cluster is temporarily unavailable, e.g. stream has no leader
+	var apiErr *nats.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code >= 500
+	}
+
+	return false
+}
+
+// accepts reports whether event should be given up after it failed retries
+// times with err. Only errors of the message itself count against maxRetries,
+// so events are never given up while server is unavailable.
+func (q *deadLetterQueue) accepts(err error, retries int) bool {
+
+	if q.kind == "" || q.kind == DeadLetterNone {
+		return false
+	}
+
+	if isPermanentError(err) {
+		return true
+	}
+
+	if isTransientError(err) {
+		return false
+	}
+
+	return q.maxRetries > 0 && retries >= q.maxRetries
+}
+
+// put keeps trying until the record was written, it returns false if source
+// was stopped
+func (q *deadLetterQueue) put(record *DeadLetter, cause error) bool {
+
+	record.Source = q.source.name
+	record.Time = time.Now()
+	record.Error = cause.Error()
+	record.Permanent = isPermanentError(cause)
+
+	log.WithFields(log.Fields{
+		"source":  record.Source,
+		"table":   record.Table,
+		"msgId":   record.MsgID,
+		"retries": record.Retries,
+	}).Error("Event was moved to dead letter: ", record.Error)
+
+	for {
+		var err error
+		switch q.kind {
+		case DeadLetterSubject:
+			err = q.publish(record)
+		case DeadLetterFile:
+			err = q.write(record)
+		default:
+			err = fmt.Errorf("Unknown dead letter type \"%s\"", q.kind)
+		}
+
+		if err == nil {
+			deadLettersCounter.WithLabelValues(record.Source, record.Table).Inc()
+			return true
+		}
+
+		log.Error("Failed to write dead letter: ", err, ", retry ...")
+
+		select {
+		case <-time.After(time.Second):
+		case <-q.source.done:
+			return false
+		}
+	}
+}
+
+func (q *deadLetterQueue) publish(record *DeadLetter) error {
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	msg := &nats.Msg{
+		Subject: q.subject,
+		Header:  nats.Header{},
+		Data:    data,
+	}
+
+	msg.Header.Set("Nats-Msg-Id", record.MsgID+"-dlq")
+
+	_, err = q.source.publisher.PublishMsg(msg)
+	if errors.Is(err, nats.ErrMaxPayload) && record.Payload != nil {
+		// The payload is why it was rejected, so keep the record without it
+		record.Payload = nil
+		return q.publish(record)
+	}
+
+	return err
+}
+
+// write appends record to spool file of source, one JSON document per line
+func (q *deadLetterQueue) write(record *DeadLetter) error {
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.file == nil {
+		err := os.MkdirAll(q.path, 0755)
+		if err != nil {
+			return err
+		}
+
+		f, err := os.OpenFile(filepath.Join(q.path, q.source.name+".jsonl"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+
+		q.file = f
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.file.Write(append(data, '\n'))
+	if err != nil {
+		return err
+	}
+
+	return q.file.Sync()
+}
+
+func (q *deadLetterQueue) close() {
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.file != nil {
+		q.file.Close()
+		q.file = nil
+	}
+}
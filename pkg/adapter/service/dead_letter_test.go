@@ -0,0 +1,85 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestErrorClassification(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		err       error
+		permanent bool
+		transient bool
+	}{
+		{"max payload", nats.ErrMaxPayload, true, false},
+		{"bad subject", nats.ErrBadSubject, true, false},
+		{"bad header", nats.ErrBadHeaderMsg, true, false},
+		{"message rejected", &nats.APIError{Code: 400, Description: "message size exceeds maximum allowed"}, true, false},
+		{"wrapped rejection", fmt.Errorf("publish: %w", &nats.APIError{Code: 400}), true, false},
+		{"connection closed", nats.ErrConnectionClosed, false, true},
+		{"reconnecting", nats.ErrConnectionReconnecting, false, true},
+		{"disconnected", nats.ErrDisconnected, false, true},
+		{"no servers", nats.ErrNoServers, false, true},
+		{"timeout", nats.ErrTimeout, false, true},
+		{"no responders", nats.ErrNoResponders, false, true},
+		{"no stream response", nats.ErrNoStreamResponse, false, true},
+		{"publisher closed", nats.ErrJetStreamPublisherClosed, false, true},
+		{"deadline", context.DeadlineExceeded, false, true},
+		{"wrapped timeout", fmt.Errorf("publish: %w", nats.ErrTimeout), false, true},
+		{"no leader", &nats.APIError{Code: 503, Description: "JetStream system temporarily unavailable"}, false, true},
+		{"duplicate", &nats.APIError{Code: 409}, false, false},
+		{"unknown", errors.New("unknown"), false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isPermanentError(tt.err); got != tt.permanent {
+				t.Fatalf("isPermanentError(%v) = %v, want %v", tt.err, got, tt.permanent)
+			}
+
+			if got := isTransientError(tt.err); got != tt.transient {
+				t.Fatalf("isTransientError(%v) = %v, want %v", tt.err, got, tt.transient)
+			}
+		})
+	}
+}
+
+// Events are never given up while server is unavailable
+func TestDeadLetterAccepts(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		kind       string
+		maxRetries int
+		err        error
+		retries    int
+		want       bool
+	}{
+		{"disabled", DeadLetterNone, 3, nats.ErrMaxPayload, 0, false},
+		{"permanent at once", DeadLetterFile, 3, nats.ErrMaxPayload, 0, true},
+		{"transient never", DeadLetterFile, 3, nats.ErrTimeout, 100, false},
+		{"transient without retries", DeadLetterFile, 0, nats.ErrNoServers, 100, false},
+		{"unknown before retries", DeadLetterFile, 3, errors.New("unknown"), 2, false},
+		{"unknown after retries", DeadLetterFile, 3, errors.New("unknown"), 3, true},
+		{"unknown without retries", DeadLetterFile, 0, errors.New("unknown"), 100, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &deadLetterQueue{
+				kind:       tt.kind,
+				maxRetries: tt.maxRetries,
+			}
+
+			if got := q.accepts(tt.err, tt.retries); got != tt.want {
+				t.Fatalf("accepts(%v, %d) = %v, want %v", tt.err, tt.retries, got, tt.want)
+			}
+		})
+	}
+}
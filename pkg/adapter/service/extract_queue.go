@@ -1,7 +1,11 @@
 package adapter
 
 import (
+	"fmt"
+	"strings"
 	"sync"
+
+	log "github.com/sirupsen/logrus"
 )
 
 type OperationType int8
@@ -11,8 +15,26 @@ const (
 	UpdateOperation
 	DeleteOperation
 	SnapshotOperation
+	TruncateOperation
 )
 
+func (op OperationType) String() string {
+	switch op {
+	case InsertOperation:
+		return "insert"
+	case UpdateOperation:
+		return "update"
+	case DeleteOperation:
+		return "delete"
+	case SnapshotOperation:
+		return "snapshot"
+	case TruncateOperation:
+		return "truncate"
+	}
+
+	return "unknown"
+}
+
 var cdcEventPool = sync.Pool{
 	New: func() interface{} {
 		return &CDCEvent{}
@@ -27,6 +49,20 @@ type CDCEvent struct {
 	After     map[string]interface{}
 	Before    map[string]interface{}
 	EventPKs  string
+	EventID   string
+	Partial   bool // only columns in statement were known
+
+	// keyChanged is set if an update changed primary key of row
+	keyChanged bool
+
+	// generation of checkpoint when event was read, see ResetCheckpoint
+	generation uint64
+}
+
+// releaseCDCEvent resets event before it is reused
+func releaseCDCEvent(event *CDCEvent) {
+	*event = CDCEvent{}
+	cdcEventPool.Put(event)
 }
 
 func (database *Database) convertValue(v interface{}) interface{} {
@@ -38,8 +74,6 @@ func (database *Database) convertValue(v interface{}) interface{} {
 	default:
 		return value
 	}
-
-	return v
 }
 
 func (database *Database) processSnapshotEvent(tableName string, eventPayload map[string]interface{}) *CDCEvent {
@@ -62,6 +96,37 @@ func (database *Database) processSnapshotEvent(tableName string, eventPayload ma
 	result.Table = tableName
 	result.After = afterValue
 	result.Before = nil
+	result.EventID = ""
 	return result
 
 }
+
+// getPKColumns returns names of primary key columns, rows of table are not
+// partitioned by key if it failed
+func (database *Database) getPKColumns(tableName string) []string {
+
+	table, err := database.GetCanalConnection().GetTable(database.source.info.DBName, tableName)
+	if err != nil {
+		log.Warn("Failed to get primary key of ", tableName, ": ", err)
+		return nil
+	}
+
+	columns := make([]string, len(table.PKColumns))
+	for i, idx := range table.PKColumns {
+		columns[i] = table.Columns[idx].Name
+	}
+
+	return columns
+}
+
+// joinSnapshotPKs joins primary key values in the same way as binlog events,
+// so snapshot row is published by the same partition as its later changes
+func joinSnapshotPKs(pkColumns []string, row map[string]interface{}) string {
+
+	pks := make([]string, len(pkColumns))
+	for i, column := range pkColumns {
+		pks[i] = fmt.Sprintf("%v", row[column])
+	}
+
+	return strings.Join(pks, "-")
+}
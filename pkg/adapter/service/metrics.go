@@ -0,0 +1,89 @@
+package adapter
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const metricsNamespace = "gravity_adapter_mysql"
+
+var (
+	eventsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "events_total",
+		Help:      "Number of events published",
+	}, []string{"source", "table", "operation"})
+
+	publishedBytesCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "published_bytes_total",
+		Help:      "Number of payload bytes published",
+	}, []string{"source", "table"})
+
+	publishErrorsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "publish_errors_total",
+		Help:      "Number of failed publish attempts",
+	}, []string{"source", "table"})
+
+	publishRetriesCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "publish_retries_total",
+		Help:      "Number of messages published again after an acknowledgement timeout",
+	}, []string{"source"})
+
+	deadLettersCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "dead_letters_total",
+		Help:      "Number of events moved to dead letter because they could not be published",
+	}, []string{"source", "table"})
+
+	oversizeEventsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "oversize_events_total",
+		Help:      "Number of events whose payload exceeded maximum message size",
+	}, []string{"source", "table", "strategy"})
+
+	skippedStatementsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "skipped_statements_total",
+		Help:      "Number of statements in statement-based binlog which could not be converted into events",
+	}, []string{"source", "reason"})
+
+	publishAckLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "publish_ack_latency_seconds",
+		Help:      "Time between publishing a message and receiving its acknowledgement",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 16),
+	}, []string{"source"})
+
+	pendingAcksGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "pending_async_acks",
+		Help:      "Number of published messages waiting for acknowledgement",
+	}, []string{"source"})
+
+	snapshotRowsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "snapshot_rows_total",
+		Help:      "Number of rows read by initial load",
+	}, []string{"source", "table"})
+
+	snapshotInProgressGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "snapshot_in_progress",
+		Help:      "Whether initial load of the table is in progress",
+	}, []string{"source", "table"})
+
+	lagSecondsGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "binlog_lag_seconds",
+		Help:      "Replication lag in seconds",
+	}, []string{"source"})
+
+	lagBytesGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "binlog_lag_bytes",
+		Help:      "Replication lag in binlog bytes",
+	}, []string{"source"})
+)
@@ -1,10 +1,389 @@
 package parser
 
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	tidb_parser "github.com/pingcap/tidb/pkg/parser"
+	"github.com/pingcap/tidb/pkg/parser/ast"
+	"github.com/pingcap/tidb/pkg/parser/opcode"
+	_ "github.com/pingcap/tidb/pkg/parser/test_driver"
+)
+
+const (
+	InsertOperation = "insert"
+	UpdateOperation = "update"
+	DeleteOperation = "delete"
+)
+
+var (
+	ErrNotDMLStatement      = errors.New("not a DML statement")
+	ErrUnsupportedStatement = errors.New("unsupported statement")
+)
+
 type Parser struct {
-	sqlStr      string
-	sqlStrState string
-	Operation   string
-	Table       string
-	BeforeData  map[string]interface{}
-	AfterData   map[string]interface{}
+	sqlStr    string
+	parser    *tidb_parser.Parser
+	Timestamp time.Time
+
+	// LastInsertID is value of LAST_INSERT_ID() which was recorded in binlog
+	// for the statement, nil if it was not
+	LastInsertID *uint64
+}
+
+type Result struct {
+	Operation  string
+	Schema     string
+	Table      string
+	BeforeData map[string]interface{}
+	AfterData  map[string]interface{}
+}
+
+// Statement is one statement of a query. Results are only available if it is
+// a supported DML statement, Err tells why it is not supported otherwise.
+type Statement struct {
+	Node    ast.StmtNode
+	Text    string
+	DML     bool
+	Results []*Result
+	Err     error
+}
+
+func NewParser() *Parser {
+	return &Parser{
+		parser: tidb_parser.New(),
+	}
+}
+
+// Parse converts a simple INSERT, UPDATE or DELETE statement into row changes.
+// Values are taken from the statement itself, so UPDATE and DELETE only carry
+// the columns referenced by their WHERE equality conditions.
+func (p *Parser) Parse(sqlStr string) ([]*Result, error) {
+
+	stmts, err := p.ParseStatements(sqlStr)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*Result, 0)
+	for _, stmt := range stmts {
+		if !stmt.DML {
+			return nil, ErrNotDMLStatement
+		}
+
+		if stmt.Err != nil {
+			return nil, stmt.Err
+		}
+
+		results = append(results, stmt.Results...)
+	}
+
+	return results, nil
+}
+
+// ParseStatements converts each statement of a query on its own, so
+// statements which are not supported do not affect the others
+func (p *Parser) ParseStatements(sqlStr string) ([]*Statement, error) {
+
+	stmts, _, err := p.parser.Parse(sqlStr, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	statements := make([]*Statement, 0, len(stmts))
+	for _, stmt := range stmts {
+
+		statement := &Statement{
+			Node: stmt,
+			Text: stmt.Text(),
+			DML:  true,
+		}
+
+		p.sqlStr = statement.Text
+
+		switch s := stmt.(type) {
+		case *ast.InsertStmt:
+			statement.Results, statement.Err = p.parseInsert(s)
+		case *ast.UpdateStmt:
+			statement.Results, statement.Err = p.parseUpdate(s)
+		case *ast.DeleteStmt:
+			statement.Results, statement.Err = p.parseDelete(s)
+		default:
+			if _, ok := stmt.(ast.DMLNode); ok {
+				statement.Err = p.unsupported("statement type")
+			} else {
+				statement.DML = false
+			}
+		}
+
+		statements = append(statements, statement)
+	}
+
+	return statements, nil
+}
+
+func (p *Parser) unsupported(reason string) error {
+	return fmt.Errorf("%w: %s: %s", ErrUnsupportedStatement, reason, p.sqlStr)
+}
+
+func (p *Parser) parseInsert(stmt *ast.InsertStmt) ([]*Result, error) {
+
+	if stmt.IsReplace {
+		return nil, p.unsupported("REPLACE")
+	}
+
+	if stmt.Select != nil {
+		return nil, p.unsupported("INSERT ... SELECT")
+	}
+
+	if len(stmt.OnDuplicate) > 0 {
+		return nil, p.unsupported("ON DUPLICATE KEY UPDATE")
+	}
+
+	if len(stmt.Columns) == 0 {
+		return nil, p.unsupported("INSERT without column list")
+	}
+
+	schema, table, err := p.parseTable(stmt.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*Result, 0, len(stmt.Lists))
+	for _, list := range stmt.Lists {
+
+		if len(list) != len(stmt.Columns) {
+			return nil, p.unsupported("column count does not match value count")
+		}
+
+		after := make(map[string]interface{}, len(list))
+		for i, expr := range list {
+			v, err := p.parseValue(expr)
+			if err != nil {
+				return nil, err
+			}
+
+			after[stmt.Columns[i].Name.O] = v
+		}
+
+		results = append(results, &Result{
+			Operation: InsertOperation,
+			Schema:    schema,
+			Table:     table,
+			AfterData: after,
+		})
+	}
+
+	return results, nil
+}
+
+func (p *Parser) parseUpdate(stmt *ast.UpdateStmt) ([]*Result, error) {
+
+	if stmt.MultipleTable {
+		return nil, p.unsupported("multiple-table UPDATE")
+	}
+
+	if stmt.Order != nil || stmt.Limit != nil {
+		return nil, p.unsupported("UPDATE with ORDER BY or LIMIT")
+	}
+
+	schema, table, err := p.parseTable(stmt.TableRefs)
+	if err != nil {
+		return nil, err
+	}
+
+	before, err := p.parseWhere(stmt.Where)
+	if err != nil {
+		return nil, err
+	}
+
+	after := make(map[string]interface{}, len(before)+len(stmt.List))
+	for k, v := range before {
+		after[k] = v
+	}
+
+	for _, assignment := range stmt.List {
+		v, err := p.parseValue(assignment.Expr)
+		if err != nil {
+			return nil, err
+		}
+
+		after[assignment.Column.Name.O] = v
+	}
+
+	return []*Result{
+		{
+			Operation:  UpdateOperation,
+			Schema:     schema,
+			Table:      table,
+			BeforeData: before,
+			AfterData:  after,
+		},
+	}, nil
+}
+
+func (p *Parser) parseDelete(stmt *ast.DeleteStmt) ([]*Result, error) {
+
+	if stmt.IsMultiTable {
+		return nil, p.unsupported("multiple-table DELETE")
+	}
+
+	if stmt.Order != nil || stmt.Limit != nil {
+		return nil, p.unsupported("DELETE with ORDER BY or LIMIT")
+	}
+
+	schema, table, err := p.parseTable(stmt.TableRefs)
+	if err != nil {
+		return nil, err
+	}
+
+	before, err := p.parseWhere(stmt.Where)
+	if err != nil {
+		return nil, err
+	}
+
+	return []*Result{
+		{
+			Operation:  DeleteOperation,
+			Schema:     schema,
+			Table:      table,
+			BeforeData: before,
+		},
+	}, nil
+}
+
+func (p *Parser) parseTable(refs *ast.TableRefsClause) (string, string, error) {
+
+	if refs == nil || refs.TableRefs == nil || refs.TableRefs.Right != nil {
+		return "", "", p.unsupported("table reference")
+	}
+
+	source, ok := refs.TableRefs.Left.(*ast.TableSource)
+	if !ok {
+		return "", "", p.unsupported("table reference")
+	}
+
+	tableName, ok := source.Source.(*ast.TableName)
+	if !ok {
+		return "", "", p.unsupported("table reference")
+	}
+
+	return tableName.Schema.O, tableName.Name.O, nil
+}
+
+// parseWhere only accepts "column = value" conditions joined by AND
+func (p *Parser) parseWhere(where ast.ExprNode) (map[string]interface{}, error) {
+
+	if where == nil {
+		return nil, p.unsupported("missing WHERE clause")
+	}
+
+	data := make(map[string]interface{})
+
+	var walk func(expr ast.ExprNode) error
+	walk = func(expr ast.ExprNode) error {
+		switch e := expr.(type) {
+		case *ast.ParenthesesExpr:
+			return walk(e.Expr)
+		case *ast.BinaryOperationExpr:
+			switch e.Op {
+			case opcode.LogicAnd:
+				if err := walk(e.L); err != nil {
+					return err
+				}
+				return walk(e.R)
+			case opcode.EQ:
+				column, valueExpr := e.L, e.R
+				if _, ok := column.(*ast.ColumnNameExpr); !ok {
+					column, valueExpr = e.R, e.L
+				}
+
+				c, ok := column.(*ast.ColumnNameExpr)
+				if !ok {
+					return p.unsupported("WHERE condition")
+				}
+
+				if _, ok := data[c.Name.Name.O]; ok {
+					return p.unsupported("column compared more than once in WHERE")
+				}
+
+				v, err := p.parseValue(valueExpr)
+				if err != nil {
+					return err
+				}
+
+				data[c.Name.Name.O] = v
+				return nil
+			}
+		}
+
+		return p.unsupported("WHERE condition")
+	}
+
+	err := walk(where)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (p *Parser) parseValue(expr ast.ExprNode) (interface{}, error) {
+
+	value, err := p.parseExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := value.Eval(&Env{
+		Timestamp:    p.Timestamp,
+		LastInsertID: p.LastInsertID,
+	})
+	if err != nil {
+		return nil, p.unsupported(err.Error())
+	}
+
+	return data, nil
+}
+
+func (p *Parser) parseExpr(expr ast.ExprNode) (*Value, error) {
+
+	value := NewValue()
+
+	switch e := expr.(type) {
+	case ast.ValueExpr:
+		value.Type = LiteralValueType
+		value.Data = e.GetValue()
+	case *ast.ParenthesesExpr:
+		return p.parseExpr(e.Expr)
+	case *ast.UnaryOperationExpr:
+		if e.Op != opcode.Minus {
+			return nil, p.unsupported("expression")
+		}
+
+		v, err := p.parseExpr(e.V)
+		if err != nil {
+			return nil, err
+		}
+
+		value.Type = FuncValueType
+		value.Data = "-"
+		value.Params = append(value.Params, v)
+	case *ast.FuncCallExpr:
+		value.Type = FuncValueType
+		value.Data = e.FnName.L
+		for _, arg := range e.Args {
+			v, err := p.parseExpr(arg)
+			if err != nil {
+				return nil, err
+			}
+
+			value.Params = append(value.Params, v)
+		}
+	default:
+		return nil, p.unsupported("expression")
+	}
+
+	return value, nil
 }
@@ -0,0 +1,271 @@
+package parser
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+
+	timestamp := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		sql     string
+		results []*Result
+	}{
+		{
+			name: "insert",
+			sql:  "INSERT INTO accounts (id, name) VALUES (1, 'fred')",
+			results: []*Result{
+				{
+					Operation: InsertOperation,
+					Table:     "accounts",
+					AfterData: map[string]interface{}{"id": int64(1), "name": "fred"},
+				},
+			},
+		},
+		{
+			name: "insert multiple rows",
+			sql:  "INSERT INTO test.accounts (id, name) VALUES (1, 'fred'), (2, 'wilma')",
+			results: []*Result{
+				{
+					Operation: InsertOperation,
+					Schema:    "test",
+					Table:     "accounts",
+					AfterData: map[string]interface{}{"id": int64(1), "name": "fred"},
+				},
+				{
+					Operation: InsertOperation,
+					Schema:    "test",
+					Table:     "accounts",
+					AfterData: map[string]interface{}{"id": int64(2), "name": "wilma"},
+				},
+			},
+		},
+		{
+			name: "insert with functions",
+			sql:  "INSERT INTO accounts (id, balance, created_at, day) VALUES (-1, -2.5, NOW(), CURDATE())",
+			results: []*Result{
+				{
+					Operation: InsertOperation,
+					Table:     "accounts",
+					AfterData: map[string]interface{}{
+						"id":         int64(-1),
+						"balance":    "-2.5",
+						"created_at": timestamp,
+						"day":        "2024-05-06",
+					},
+				},
+			},
+		},
+		{
+			name: "update",
+			sql:  "UPDATE accounts SET name = 'barney' WHERE id = 1",
+			results: []*Result{
+				{
+					Operation:  UpdateOperation,
+					Table:      "accounts",
+					BeforeData: map[string]interface{}{"id": int64(1)},
+					AfterData:  map[string]interface{}{"id": int64(1), "name": "barney"},
+				},
+			},
+		},
+		{
+			name: "update primary key",
+			sql:  "UPDATE accounts SET id = 2 WHERE (id = 1 AND 'us' = region)",
+			results: []*Result{
+				{
+					Operation:  UpdateOperation,
+					Table:      "accounts",
+					BeforeData: map[string]interface{}{"id": int64(1), "region": "us"},
+					AfterData:  map[string]interface{}{"id": int64(2), "region": "us"},
+				},
+			},
+		},
+		{
+			name: "delete",
+			sql:  "DELETE FROM accounts WHERE id = 1 AND region = 'us'",
+			results: []*Result{
+				{
+					Operation:  DeleteOperation,
+					Table:      "accounts",
+					BeforeData: map[string]interface{}{"id": int64(1), "region": "us"},
+				},
+			},
+		},
+		{
+			name: "integer limits",
+			sql:  "INSERT INTO accounts (a, b, c, d) VALUES (-9223372036854775808, -9223372036854775807, 18446744073709551615, -18446744073709551615)",
+			results: []*Result{
+				{
+					Operation: InsertOperation,
+					Table:     "accounts",
+					AfterData: map[string]interface{}{
+						"a": int64(math.MinInt64),
+						"b": int64(-math.MaxInt64),
+						"c": uint64(math.MaxUint64),
+						"d": "-18446744073709551615",
+					},
+				},
+			},
+		},
+		{
+			name: "last insert id",
+			sql:  "INSERT INTO orders (id, account_id, ref) VALUES (1, LAST_INSERT_ID(), LAST_INSERT_ID(5))",
+			results: []*Result{
+				{
+					Operation: InsertOperation,
+					Table:     "orders",
+					AfterData: map[string]interface{}{"id": int64(1), "account_id": uint64(42), "ref": int64(5)},
+				},
+			},
+		},
+		{
+			name: "multiple statements",
+			sql:  "DELETE FROM accounts WHERE id = 1; INSERT INTO accounts (id) VALUES (3)",
+			results: []*Result{
+				{
+					Operation:  DeleteOperation,
+					Table:      "accounts",
+					BeforeData: map[string]interface{}{"id": int64(1)},
+				},
+				{
+					Operation: InsertOperation,
+					Table:     "accounts",
+					AfterData: map[string]interface{}{"id": int64(3)},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			lastInsertID := uint64(42)
+
+			p := NewParser()
+			p.Timestamp = timestamp
+			p.LastInsertID = &lastInsertID
+
+			results, err := p.Parse(tt.sql)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %v", tt.sql, err)
+			}
+
+			if !reflect.DeepEqual(results, tt.results) {
+				t.Fatalf("Parse(%q)\n got: %+v\nwant: %+v", tt.sql, dump(results), dump(tt.results))
+			}
+		})
+	}
+}
+
+func TestParseUnsupported(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		sql       string
+		timestamp time.Time
+		err       error
+	}{
+		{"replace", "REPLACE INTO accounts (id) VALUES (1)", time.Now(), ErrUnsupportedStatement},
+		{"insert select", "INSERT INTO accounts (id) SELECT id FROM users", time.Now(), ErrUnsupportedStatement},
+		{"on duplicate key", "INSERT INTO accounts (id) VALUES (1) ON DUPLICATE KEY UPDATE id = 2", time.Now(), ErrUnsupportedStatement},
+		{"insert without columns", "INSERT INTO accounts VALUES (1)", time.Now(), ErrUnsupportedStatement},
+		{"update without where", "UPDATE accounts SET name = 'fred'", time.Now(), ErrUnsupportedStatement},
+		{"update with range", "UPDATE accounts SET name = 'fred' WHERE id > 1", time.Now(), ErrUnsupportedStatement},
+		{"update with or", "UPDATE accounts SET name = 'fred' WHERE id = 1 OR id = 2", time.Now(), ErrUnsupportedStatement},
+		{"update with limit", "UPDATE accounts SET name = 'fred' WHERE id = 1 LIMIT 1", time.Now(), ErrUnsupportedStatement},
+		{"update with expression", "UPDATE accounts SET balance = balance + 1 WHERE id = 1", time.Now(), ErrUnsupportedStatement},
+		{"multiple-table update", "UPDATE accounts a, users u SET a.name = u.name WHERE a.id = u.id", time.Now(), ErrUnsupportedStatement},
+		{"delete with in", "DELETE FROM accounts WHERE id IN (1, 2)", time.Now(), ErrUnsupportedStatement},
+		{"multiple-table delete", "DELETE a FROM accounts a JOIN users u ON a.id = u.id WHERE u.id = 1", time.Now(), ErrUnsupportedStatement},
+		{"function without timestamp", "INSERT INTO accounts (id, created_at) VALUES (1, NOW())", time.Time{}, ErrUnsupportedStatement},
+		{"unknown function", "INSERT INTO accounts (id, name) VALUES (1, UUID())", time.Now(), ErrUnsupportedStatement},
+		{"last insert id without value", "INSERT INTO accounts (id) VALUES (LAST_INSERT_ID())", time.Now(), ErrUnsupportedStatement},
+		{"column compared twice", "DELETE FROM accounts WHERE id = 1 AND id = 2", time.Now(), ErrUnsupportedStatement},
+		{"ddl", "CREATE TABLE accounts (id INT PRIMARY KEY)", time.Now(), ErrNotDMLStatement},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			p := NewParser()
+			p.Timestamp = tt.timestamp
+
+			results, err := p.Parse(tt.sql)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Parse(%q) = %v, %v, want error %v", tt.sql, dump(results), err, tt.err)
+			}
+		})
+	}
+}
+
+func TestParseStatements(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		sql     string
+		dml     []bool
+		errs    []bool
+		results []int
+	}{
+		{
+			name:    "dml before ddl",
+			sql:     "INSERT INTO accounts (id) VALUES (1); TRUNCATE TABLE users",
+			dml:     []bool{true, false},
+			errs:    []bool{false, false},
+			results: []int{1, 0},
+		},
+		{
+			name:    "ddl before dml",
+			sql:     "CREATE TABLE t (id INT PRIMARY KEY); DELETE FROM accounts WHERE id = 1",
+			dml:     []bool{false, true},
+			errs:    []bool{false, false},
+			results: []int{0, 1},
+		},
+		{
+			name:    "unsupported statement among others",
+			sql:     "UPDATE accounts SET id = id + 1 WHERE id = 1; INSERT INTO accounts (id) VALUES (2), (3)",
+			dml:     []bool{true, true},
+			errs:    []bool{true, false},
+			results: []int{0, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			p := NewParser()
+			p.Timestamp = time.Now()
+
+			stmts, err := p.ParseStatements(tt.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(stmts) != len(tt.dml) {
+				t.Fatalf("got %d statements, want %d", len(stmts), len(tt.dml))
+			}
+
+			for i, stmt := range stmts {
+				if stmt.DML != tt.dml[i] || (stmt.Err != nil) != tt.errs[i] || len(stmt.Results) != tt.results[i] {
+					t.Fatalf("statement %d %q: dml %v, err %v, %d results", i, stmt.Text, stmt.DML, stmt.Err, len(stmt.Results))
+				}
+			}
+		})
+	}
+}
+
+func dump(results []*Result) []Result {
+
+	values := make([]Result, len(results))
+	for i, result := range results {
+		values[i] = *result
+	}
+
+	return values
+}
@@ -1,5 +1,14 @@
 package parser
 
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/pingcap/tidb/pkg/parser/test_driver"
+)
+
 type Value struct {
 	Type   ValueType
 	Params []*Value
@@ -11,10 +20,117 @@ type ValueType uint8
 const (
 	UnknownType = ValueType(iota + 1)
 	FuncValueType
+	LiteralValueType
 )
 
+// Env is state of the session which a statement was executed in
+type Env struct {
+	Timestamp    time.Time
+	LastInsertID *uint64
+}
+
 func NewValue() *Value {
 	return &Value{
 		Params: make([]*Value, 0),
 	}
 }
+
+// Eval resolves the value. Time functions are evaluated against timestamp of
+// env, which is the time of the statement recorded in the binlog, and are
+// returned as time.Time so they are formatted like values of row events.
+func (v *Value) Eval(env *Env) (interface{}, error) {
+
+	switch v.Type {
+	case LiteralValueType:
+		switch data := v.Data.(type) {
+		case *test_driver.MyDecimal:
+			return data.String(), nil
+		case test_driver.BinaryLiteral:
+			return string(data), nil
+		case []byte:
+			return string(data), nil
+		default:
+			return data, nil
+		}
+	case FuncValueType:
+		return v.evalFunc(env)
+	}
+
+	return nil, fmt.Errorf("unknown value type")
+}
+
+func (v *Value) evalFunc(env *Env) (interface{}, error) {
+
+	timestamp := env.Timestamp
+
+	name, _ := v.Data.(string)
+
+	switch name {
+	case "-":
+		if len(v.Params) != 1 {
+			return nil, fmt.Errorf("invalid negative value")
+		}
+
+		data, err := v.Params[0].Eval(env)
+		if err != nil {
+			return nil, err
+		}
+
+		switch n := data.(type) {
+		case int64:
+			if n == math.MinInt64 {
+				return uint64(math.MaxInt64) + 1, nil
+			}
+
+			return -n, nil
+		case uint64:
+			// Literals out of range of int64 are decimals in MySQL
+			if n <= math.MaxInt64 {
+				return -int64(n), nil
+			}
+
+			if n == math.MaxInt64+1 {
+				return int64(math.MinInt64), nil
+			}
+
+			return "-" + strconv.FormatUint(n, 10), nil
+		case float64:
+			return -n, nil
+		case float32:
+			return -n, nil
+		case string:
+			return "-" + n, nil
+		}
+
+		return nil, fmt.Errorf("invalid negative value")
+	case "now", "current_timestamp", "localtime", "localtimestamp", "utc_timestamp":
+		if len(v.Params) != 0 {
+			return nil, fmt.Errorf("function %s with precision", name)
+		}
+
+		if timestamp.IsZero() {
+			return nil, fmt.Errorf("function %s without timestamp of statement", name)
+		}
+
+		return timestamp, nil
+	case "last_insert_id":
+		// LAST_INSERT_ID(expr) sets the value and returns it
+		if len(v.Params) == 1 {
+			return v.Params[0].Eval(env)
+		}
+
+		if len(v.Params) != 0 || env.LastInsertID == nil {
+			return nil, fmt.Errorf("function %s without value recorded in binlog", name)
+		}
+
+		return *env.LastInsertID, nil
+	case "curdate", "current_date", "utc_date":
+		if timestamp.IsZero() {
+			return nil, fmt.Errorf("function %s without timestamp of statement", name)
+		}
+
+		return timestamp.UTC().Format("2006-01-02"), nil
+	}
+
+	return nil, fmt.Errorf("function %s", name)
+}
@@ -0,0 +1,125 @@
+package adapter
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+const (
+	DefaultPartitions    = 16
+	DefaultPartitionSize = 128
+)
+
+type pipelineEvent struct {
+	event *CDCEvent
+	seq   uint64
+}
+
+// pipeline prepares and publishes events with a set of partitions. Events are
+// routed by table and primary key, so events of the same row are always
+// published in binlog order by the same partition, while different rows are
+// published in parallel.
+type pipeline struct {
+	source     *Source
+	partitions []chan *pipelineEvent
+	pending    sync.WaitGroup
+
+	// process publishes event of partition, it is processEvent of source
+	process func(event *CDCEvent, seq uint64)
+}
+
+func newPipeline(source *Source, partitions int, size int) *pipeline {
+
+	p := &pipeline{
+		source:     source,
+		partitions: make([]chan *pipelineEvent, partitions),
+		process:    source.processEvent,
+	}
+
+	for i := range p.partitions {
+		p.partitions[i] = make(chan *pipelineEvent, size)
+	}
+
+	return p
+}
+
+func (p *pipeline) start() {
+	for _, partition := range p.partitions {
+		go p.worker(partition)
+	}
+}
+
+// partitionOf returns partition of event, rows without primary key are
+// spread randomly because their keys are random
+func (p *pipeline) partitionOf(event *CDCEvent) int {
+
+	h := fnv.New32a()
+	h.Write([]byte(event.Table))
+	h.Write([]byte{0})
+	h.Write([]byte(event.EventPKs))
+
+	return int(h.Sum32() % uint32(len(p.partitions)))
+}
+
+// push must be called by a single goroutine, it returns false if source was
+// stopped
+func (p *pipeline) push(event *CDCEvent) bool {
+
+	// Truncation affects all rows of table, and an update which changes
+	// primary key is routed by the key before, so events before it must be
+	// published first
+	keyChanged := event.keyChanged
+	if event.Operation == TruncateOperation || keyChanged {
+		p.flush()
+	}
+
+	item := &pipelineEvent{
+		event: event,
+		seq:   p.source.tracker.add(event),
+	}
+
+	p.pending.Add(1)
+
+	select {
+	case p.partitions[p.partitionOf(event)] <- item:
+	case <-p.source.done:
+		p.pending.Done()
+		return false
+	}
+
+	// Later events of the new key go to another partition, they must not
+	// be published before the update
+	if keyChanged {
+		p.flush()
+	}
+
+	return true
+}
+
+// flush waits until all events were published
+func (p *pipeline) flush() {
+
+	flushed := make(chan struct{})
+	go func() {
+		p.pending.Wait()
+		close(flushed)
+	}()
+
+	select {
+	case <-flushed:
+	case <-p.source.done:
+	}
+}
+
+func (p *pipeline) worker(partition chan *pipelineEvent) {
+
+	for {
+		select {
+		case item := <-partition:
+			p.process(item.event, item.seq)
+			p.pending.Done()
+		case <-p.source.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package adapter
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPipelineOrder(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		partitions int
+		size       int
+		keys       int
+		events     int
+		truncateAt int
+	}{
+		{"single partition", 1, 4, 8, 200, 0},
+		{"more partitions than keys", 16, 4, 3, 200, 0},
+		{"more keys than partitions", 4, 2, 50, 1000, 0},
+		{"truncate", 8, 8, 20, 400, 250},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, store := newTestSource()
+			defer close(source.done)
+
+			p := newPipeline(source, tt.partitions, tt.size)
+
+			var mu sync.Mutex
+			processed := make(map[string][]uint32)
+			var count int
+			var earlier int
+			earlierAtTruncate := -1
+			p.process = func(event *CDCEvent, seq uint64) {
+
+				// Partitions run at different speed
+				time.Sleep(time.Duration(rand.Intn(100)) * time.Microsecond)
+
+				mu.Lock()
+				count++
+				if int(event.Pos) < tt.truncateAt {
+					earlier++
+				}
+				if event.Operation == TruncateOperation {
+					earlierAtTruncate = earlier
+				}
+				processed[event.EventPKs] = append(processed[event.EventPKs], event.Pos)
+				mu.Unlock()
+
+				source.tracker.done(seq)
+			}
+
+			p.start()
+
+			for i := 1; i <= tt.events; i++ {
+				event := &CDCEvent{
+					Operation: UpdateOperation,
+					Table:     "accounts",
+					EventPKs:  fmt.Sprintf("%d", i%tt.keys),
+					PosName:   "mysql-bin.000001",
+					Pos:       uint32(i),
+				}
+
+				if i == tt.truncateAt {
+					event.Operation = TruncateOperation
+					event.EventPKs = "truncate"
+				}
+
+				if !p.push(event) {
+					t.Fatal("pipeline was stopped")
+				}
+			}
+
+			p.flush()
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if count != tt.events {
+				t.Fatalf("processed %d events, want %d", count, tt.events)
+			}
+
+			for key, positions := range processed {
+				for i := 1; i < len(positions); i++ {
+					if positions[i] <= positions[i-1] {
+						t.Fatalf("events of key %s were processed out of order: %v", key, positions)
+					}
+				}
+			}
+
+			// All events before truncation must be processed before it
+			if tt.truncateAt > 0 && earlierAtTruncate != tt.truncateAt-1 {
+				t.Fatalf("%d events before truncate were processed before it, want %d", earlierAtTruncate, tt.truncateAt-1)
+			}
+
+			if err := source.flushCheckpoint(); err != nil {
+				t.Fatal(err)
+			}
+
+			committed := store.committed()
+			for i := 1; i < len(committed); i++ {
+				if committed[i] <= committed[i-1] {
+					t.Fatalf("checkpoint moved from %d to %d", committed[i-1], committed[i])
+				}
+			}
+
+			if _, pos := source.getCheckpoint(); pos != uint32(tt.events) {
+				t.Fatalf("checkpoint = %d, want %d", pos, tt.events)
+			}
+		})
+	}
+}
+
+// An update which changes primary key is routed by the key before, events of
+// both keys must not overtake it
+func TestPipelineKeyChange(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		partitions int
+		events     int
+		changeAt   []int
+	}{
+		{"single partition", 1, 100, []int{30, 60}},
+		{"many partitions", 8, 300, []int{50, 51, 200}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, _ := newTestSource()
+			defer close(source.done)
+
+			p := newPipeline(source, tt.partitions, 4)
+
+			var mu sync.Mutex
+			var order []uint32
+			p.process = func(event *CDCEvent, seq uint64) {
+				time.Sleep(time.Duration(rand.Intn(200)) * time.Microsecond)
+
+				mu.Lock()
+				order = append(order, event.Pos)
+				mu.Unlock()
+
+				source.tracker.done(seq)
+			}
+
+			p.start()
+
+			changes := make(map[uint32]bool)
+			for _, i := range tt.changeAt {
+				changes[uint32(i)] = true
+			}
+
+			for i := 1; i <= tt.events; i++ {
+				if !p.push(&CDCEvent{
+					Operation:  UpdateOperation,
+					Table:      "accounts",
+					EventPKs:   fmt.Sprintf("%d", i%10),
+					PosName:    "mysql-bin.000001",
+					Pos:        uint32(i),
+					keyChanged: changes[uint32(i)],
+				}) {
+					t.Fatal("pipeline was stopped")
+				}
+			}
+
+			p.flush()
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if len(order) != tt.events {
+				t.Fatalf("processed %d events, want %d", len(order), tt.events)
+			}
+
+			for i, pos := range order {
+				if !changes[pos] {
+					continue
+				}
+
+				for j, other := range order {
+					if (j < i) != (other < pos) && other != pos {
+						t.Fatalf("event %d was processed out of order with update %d which changed key", other, pos)
+					}
+				}
+			}
+		})
+	}
+}
+
+// A slow partition must stop reading binlog once its queue is full
+func TestPipelineBackpressure(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		partitions int
+		size       int
+	}{
+		{"single partition", 1, 1},
+		{"larger queue", 1, 8},
+		{"more partitions", 4, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, _ := newTestSource()
+
+			p := newPipeline(source, tt.partitions, tt.size)
+
+			blocked := make(chan struct{})
+			p.process = func(event *CDCEvent, seq uint64) {
+				<-blocked
+				source.tracker.done(seq)
+			}
+
+			p.start()
+
+			// Events of the same row go to the same partition
+			var pushed int32
+			stopped := make(chan bool)
+			go func() {
+				for i := 1; ; i++ {
+					ok := p.push(&CDCEvent{
+						Operation: UpdateOperation,
+						Table:     "accounts",
+						EventPKs:  "1",
+						Pos:       uint32(i),
+					})
+					if !ok {
+						stopped <- true
+						return
+					}
+
+					atomic.AddInt32(&pushed, 1)
+				}
+			}()
+
+			// One event is held by worker, the others wait in queue
+			want := int32(tt.size + 1)
+			deadline := time.Now().Add(time.Second)
+			for atomic.LoadInt32(&pushed) < want && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+
+			time.Sleep(50 * time.Millisecond)
+			if n := atomic.LoadInt32(&pushed); n != want {
+				t.Fatalf("pushed %d events, want %d", n, want)
+			}
+
+			// Blocked push returns once source was stopped
+			close(source.done)
+			select {
+			case <-stopped:
+			case <-time.After(time.Second):
+				t.Fatal("push was not stopped with source")
+			}
+
+			close(blocked)
+		})
+	}
+}
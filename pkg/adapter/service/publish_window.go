@@ -0,0 +1,324 @@
+package adapter
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultMaxInflight = 1000
+	DefaultAckTimeout  = 30
+)
+
+type inflightMsg struct {
+	future      nats.PubAckFuture
+	publishedAt time.Time
+	posName     string
+	pos         uint32
+	seq         uint64
+	table       string
+	eventName   string
+	payload     []byte
+}
+
+func (msg *inflightMsg) deadLetter(retries int) *DeadLetter {
+	return &DeadLetter{
+		Table:       msg.table,
+		EventName:   msg.eventName,
+		MsgID:       msg.future.Msg().Header.Get("Nats-Msg-Id"),
+		PosName:     msg.posName,
+		Pos:         msg.pos,
+		Retries:     retries,
+		PayloadSize: len(msg.payload),
+		Payload:     msg.payload,
+	}
+}
+
+// publishWindow limits the number of messages waiting for acknowledgement.
+// Acknowledgements are reaped in publishing order, and reported to checkpoint
+// tracker of source.
+//
+// Once a message failed or was not acknowledged in time, the window stops
+// accepting new messages and sends all unacknowledged messages again in their
+// original order. Messages keep their IDs, so server drops the ones which
+// were stored already.
+type publishWindow struct {
+	source     *Source
+	timeout    time.Duration
+	size       int
+	mu         sync.Mutex
+	cond       *sync.Cond
+	queue      []*inflightMsg
+	reserved   int
+	recovering bool
+	closed     bool
+}
+
+func newPublishWindow(source *Source, size int, timeout time.Duration) *publishWindow {
+
+	w := &publishWindow{
+		source:  source,
+		timeout: timeout,
+		size:    size,
+		queue:   make([]*inflightMsg, 0, size),
+	}
+
+	w.cond = sync.NewCond(&w.mu)
+
+	return w
+}
+
+// acquire reserves room for a message which is going to be published, it
+// blocks while the window is full or unacknowledged messages are being sent
+// again. It returns false if source was stopped.
+func (w *publishWindow) acquire() bool {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for !w.closed && (w.recovering || len(w.queue)+w.reserved >= w.size) {
+		w.cond.Wait()
+	}
+
+	if w.closed {
+		return false
+	}
+
+	w.reserved++
+
+	return true
+}
+
+// push adds published message to window with room reserved by acquire
+func (w *publishWindow) push(msg *inflightMsg) {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.reserved--
+	w.queue = append(w.queue, msg)
+	pendingAcksGauge.WithLabelValues(w.source.name).Set(float64(len(w.queue)))
+	w.cond.Broadcast()
+}
+
+// release gives up room reserved by acquire
+func (w *publishWindow) release() {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.reserved--
+	w.cond.Broadcast()
+}
+
+func (w *publishWindow) Len() int {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return len(w.queue) + w.reserved
+}
+
+func (w *publishWindow) isRecovering() bool {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.recovering
+}
+
+func (w *publishWindow) close() {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.closed = true
+	w.cond.Broadcast()
+}
+
+// front returns the oldest message, or nil if source was stopped
+func (w *publishWindow) front() *inflightMsg {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for !w.closed && len(w.queue) == 0 {
+		w.cond.Wait()
+	}
+
+	if w.closed {
+		return nil
+	}
+
+	return w.queue[0]
+}
+
+func (w *publishWindow) pop(n int) {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.queue = w.queue[n:]
+	pendingAcksGauge.WithLabelValues(w.source.name).Set(float64(len(w.queue)))
+	w.cond.Broadcast()
+}
+
+func (w *publishWindow) run() {
+
+	go func() {
+		<-w.source.done
+		w.close()
+	}()
+
+	for {
+		msg := w.front()
+		if msg == nil {
+			return
+		}
+
+		if !w.waitAck(msg) {
+			// Nothing is sent again once source was stopped
+			select {
+			case <-w.source.done:
+				return
+			default:
+			}
+
+			w.recover()
+			continue
+		}
+
+		w.pop(1)
+		w.source.tracker.done(msg.seq)
+	}
+}
+
+// waitAck returns false if message failed or was not acknowledged in time
+func (w *publishWindow) waitAck(msg *inflightMsg) bool {
+
+	timeout := w.timeout - time.Since(msg.publishedAt)
+	if timeout < 0 {
+		timeout = 0
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-msg.future.Ok():
+		publishAckLatency.WithLabelValues(w.source.name).Observe(time.Since(msg.publishedAt).Seconds())
+		return true
+	case err := <-msg.future.Err():
+		log.WithFields(log.Fields{
+			"source": w.source.name,
+		}).Warn("Failed to publish message: ", err)
+	case <-timer.C:
+		log.WithFields(log.Fields{
+			"source": w.source.name,
+		}).Warn("Timeout waiting for acknowledgement")
+	case <-w.source.done:
+	}
+
+	return false
+}
+
+// recover sends all unacknowledged messages again in order, new messages are
+// not accepted until all of them were stored
+func (w *publishWindow) recover() {
+
+	w.mu.Lock()
+	w.recovering = true
+
+	// Wait for messages which are being published to join the queue
+	for !w.closed && w.reserved > 0 {
+		w.cond.Wait()
+	}
+
+	backlog := make([]*inflightMsg, len(w.queue))
+	copy(backlog, w.queue)
+	w.mu.Unlock()
+
+	log.WithFields(log.Fields{
+		"source":  w.source.name,
+		"backlog": len(backlog),
+	}).Warn("Sending unacknowledged messages again ...")
+
+	for _, msg := range backlog {
+
+		select {
+		case <-msg.future.Ok():
+			// Stored already
+		default:
+			if !w.republish(msg) {
+				return
+			}
+		}
+
+		w.pop(1)
+		w.source.tracker.done(msg.seq)
+	}
+
+	// Acknowledgements of messages which were sent again are useless now
+	w.source.publisher.CleanupPublisher()
+
+	log.WithFields(log.Fields{
+		"source":  w.source.name,
+		"backlog": len(backlog),
+	}).Info("All unacknowledged messages were stored")
+
+	w.mu.Lock()
+	w.recovering = false
+	w.cond.Broadcast()
+	w.mu.Unlock()
+}
+
+// republish sends message again in sync mode until it was stored or moved to
+// dead letter, it returns false if source was stopped
+func (w *publishWindow) republish(msg *inflightMsg) bool {
+
+	publishRetriesCounter.WithLabelValues(w.source.name).Inc()
+
+	for retries := 0; ; {
+		_, err := w.source.publisher.PublishMsg(msg.future.Msg())
+		if err == nil {
+			return true
+		}
+
+		publishErrorsCounter.WithLabelValues(w.source.name, msg.table).Inc()
+
+		if w.source.deadLetters.accepts(err, retries) {
+			return w.source.deadLetters.put(msg.deadLetter(retries), err)
+		}
+
+		log.Warn(err, ", retry ...")
+
+		// Unavailability of server does not count against maxRetries
+		if !isTransientError(err) {
+			retries++
+		}
+
+		select {
+		case <-time.After(time.Second):
+		case <-w.source.done:
+			return false
+		}
+	}
+}
+
+// wait returns false if messages were not acknowledged in time
+func (w *publishWindow) wait(timeout time.Duration) bool {
+
+	deadline := time.Now().Add(timeout)
+	for w.Len() > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return true
+}
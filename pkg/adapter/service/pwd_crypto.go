@@ -4,52 +4,232 @@ import (
 	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
 	"encoding/hex"
 	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
 )
 
+// Legacy key which is set at link time, it is only used to decrypt passwords
+// encrypted by older versions.
 var aesKey = "********************************"
 var key = []byte(aesKey)
 
-func PKCS7Padding(ciphertext []byte, blockSize int) []byte {
-	padding := blockSize - len(ciphertext)%blockSize
-	padtext := bytes.Repeat([]byte{byte(padding)}, padding)
+// Encrypted password is in format of "v2:<key id>:<base64 of nonce and sealed data>"
+const encryptionVersion = "v2"
 
-	return append(ciphertext, padtext...)
+var (
+	ErrNoEncryptionKey      = errors.New("No encryption key was configured, please set crypto.keys or crypto.keyFile")
+	ErrUnknownEncryptionKey = errors.New("Unknown encryption key")
+	ErrInvalidCiphertext    = errors.New("Invalid ciphertext")
+)
+
+type keyRing struct {
+	keys   map[string][]byte
+	active string
 }
 
-func PKCS7UnPadding(origData []byte) ([]byte, error) {
-	length := len(origData)
-	unpadding := int(origData[length-1])
-	if unpadding > length || unpadding <= 0 {
-		return nil, errors.New("Invalid padding size.")
+// loadKeyRing reads keys every time so rotated keys can be used without restart
+func loadKeyRing() (*keyRing, error) {
+
+	ring := &keyRing{
+		keys: make(map[string][]byte),
 	}
 
-	return origData[:(length - unpadding)], nil
+	sources := []string{viper.GetString("crypto.keys")}
+
+	keyFile := viper.GetString("crypto.keyFile")
+	if keyFile != "" {
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		sources = append(sources, string(data))
+	}
+
+	for _, source := range sources {
+		err := ring.parse(source)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	activeKey := viper.GetString("crypto.activeKey")
+	if activeKey != "" {
+		if _, ok := ring.keys[activeKey]; !ok {
+			return nil, fmt.Errorf("%v \"%s\"", ErrUnknownEncryptionKey, activeKey)
+		}
+
+		ring.active = activeKey
+	}
+
+	return ring, nil
+}
+
+// parse reads keys in format of "<id>:<hex or base64 key>", which are
+// separated by commas or lines. The first key is active by default.
+func (ring *keyRing) parse(text string) error {
+
+	entries := strings.FieldsFunc(text, func(r rune) bool {
+		return r == ',' || r == '\n' || r == '\r'
+	})
+
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return errors.New("Invalid encryption key, must be in format of <id>:<key>")
+		}
+
+		id := strings.TrimSpace(parts[0])
+		k, err := decodeKey(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return fmt.Errorf("Invalid encryption key \"%s\": %v", id, err)
+		}
+
+		ring.keys[id] = k
+		if ring.active == "" {
+			ring.active = id
+		}
+	}
+
+	return nil
+}
+
+func decodeKey(text string) ([]byte, error) {
+
+	k, err := hex.DecodeString(text)
+	if err != nil {
+		k, err = base64.StdEncoding.DecodeString(text)
+		if err != nil {
+			return nil, errors.New("key must be encoded in hex or base64")
+		}
+	}
+
+	switch len(k) {
+	case 16, 24, 32:
+		return k, nil
+	}
+
+	return nil, fmt.Errorf("key size must be 16, 24 or 32 bytes, got %d", len(k))
+}
+
+func newGCM(k []byte) (cipher.AEAD, error) {
+
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
 }
 
-// Aes Encrypt
+// Aes Encrypt with AES-GCM by using the active key
 func AesEncrypt(pwd string) (string, error) {
 
-	plaintext := []byte(pwd)
+	ring, err := loadKeyRing()
+	if err != nil {
+		return "", err
+	}
 
-	block, err := aes.NewCipher(key)
+	if ring.active == "" {
+		return "", ErrNoEncryptionKey
+	}
+
+	gcm, err := newGCM(ring.keys[ring.active])
 	if err != nil {
 		return "", err
 	}
 
-	blockSize := block.BlockSize()
-	plaintext = PKCS7Padding(plaintext, blockSize)
-	blockMode := cipher.NewCBCEncrypter(block, key[:blockSize])
-	ciphertext := make([]byte, len(plaintext))
-	blockMode.CryptBlocks(ciphertext, plaintext)
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return "", err
+	}
 
-	return hex.EncodeToString(ciphertext), nil
+	// Key ID is authenticated as well
+	sealed := gcm.Seal(nonce, nonce, []byte(pwd), []byte(ring.active))
+
+	return strings.Join([]string{
+		encryptionVersion,
+		ring.active,
+		base64.RawURLEncoding.EncodeToString(sealed),
+	}, ":"), nil
 }
 
-// Aes Decryt
+// Aes Decryt supports both versioned and legacy formats
 func AesDecrypt(pwd string) (string, error) {
 
+	if !strings.HasPrefix(pwd, encryptionVersion+":") {
+		return legacyAesDecrypt(pwd)
+	}
+
+	parts := strings.SplitN(pwd, ":", 3)
+	if len(parts) != 3 {
+		return "", ErrInvalidCiphertext
+	}
+
+	ring, err := loadKeyRing()
+	if err != nil {
+		return "", err
+	}
+
+	k, ok := ring.keys[parts[1]]
+	if !ok {
+		return "", fmt.Errorf("%v \"%s\"", ErrUnknownEncryptionKey, parts[1])
+	}
+
+	sealed, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", ErrInvalidCiphertext
+	}
+
+	gcm, err := newGCM(k)
+	if err != nil {
+		return "", err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return "", ErrInvalidCiphertext
+	}
+
+	nonce := sealed[:gcm.NonceSize()]
+	plaintext, err := gcm.Open(nil, nonce, sealed[gcm.NonceSize():], []byte(parts[1]))
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+func PKCS7UnPadding(origData []byte) ([]byte, error) {
+	length := len(origData)
+	if length == 0 {
+		return nil, errors.New("Invalid padding size.")
+	}
+
+	unpadding := int(origData[length-1])
+	if unpadding > length || unpadding <= 0 {
+		return nil, errors.New("Invalid padding size.")
+	}
+
+	return origData[:(length - unpadding)], nil
+}
+
+// legacyAesDecrypt decrypts hex encoded AES-CBC ciphertext of older versions
+func legacyAesDecrypt(pwd string) (string, error) {
+
 	ciphertext, err := hex.DecodeString(pwd)
 	if err != nil {
 		return "", err
@@ -61,8 +241,8 @@ func AesDecrypt(pwd string) (string, error) {
 	}
 
 	blockSize := block.BlockSize()
-	if len(ciphertext) < blockSize {
-		return "", errors.New("Ciphertext length is less than the AES block size.")
+	if len(ciphertext) < blockSize || len(ciphertext)%blockSize != 0 {
+		return "", errors.New("Ciphertext length is not a multiple of the AES block size.")
 	}
 
 	blockMode := cipher.NewCBCDecrypter(block, key[:blockSize])
@@ -75,3 +255,11 @@ func AesDecrypt(pwd string) (string, error) {
 
 	return string(plaintext), nil
 }
+
+// PKCS7Padding is kept for tools which still produce legacy ciphertext
+func PKCS7Padding(ciphertext []byte, blockSize int) []byte {
+	padding := blockSize - len(ciphertext)%blockSize
+	padtext := bytes.Repeat([]byte{byte(padding)}, padding)
+
+	return append(ciphertext, padtext...)
+}
@@ -0,0 +1,225 @@
+package adapter
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	testKey1 = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+	testKey2 = "1f1e1d1c1b1a191817161514131211100f0e0d0c0b0a09080706050403020100"
+)
+
+func setCryptoKeys(t *testing.T, keys string, activeKey string) {
+	t.Helper()
+
+	viper.Set("crypto.keys", keys)
+	viper.Set("crypto.activeKey", activeKey)
+	viper.Set("crypto.keyFile", "")
+
+	t.Cleanup(func() {
+		viper.Set("crypto.keys", "")
+		viper.Set("crypto.activeKey", "")
+	})
+}
+
+// legacyAesEncrypt produces ciphertext the way older versions did
+func legacyAesEncrypt(t *testing.T, pwd string) string {
+	t.Helper()
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := PKCS7Padding([]byte(pwd), block.BlockSize())
+	cipher.NewCBCEncrypter(block, key[:block.BlockSize()]).CryptBlocks(data, data)
+
+	return hex.EncodeToString(data)
+}
+
+func TestAesRoundTrip(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		keys      string
+		activeKey string
+		wantID    string
+	}{
+		{"hex key", "k1:" + testKey1, "", "k1"},
+		{"base64 key", "k1:" + base64.StdEncoding.EncodeToString([]byte("0123456789abcdef")), "", "k1"},
+		{"first key is active", "k1:" + testKey1 + ",k2:" + testKey2, "", "k1"},
+		{"active key", "k1:" + testKey1 + "\nk2:" + testKey2, "k2", "k2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setCryptoKeys(t, tt.keys, tt.activeKey)
+
+			for _, pwd := range []string{"secret", "", "密碼:with,separators\n"} {
+				encrypted, err := AesEncrypt(pwd)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !strings.HasPrefix(encrypted, encryptionVersion+":"+tt.wantID+":") {
+					t.Fatalf("encrypted with unexpected key: %s", encrypted)
+				}
+
+				decrypted, err := AesDecrypt(encrypted)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if decrypted != pwd {
+					t.Fatalf("decrypted %q, want %q", decrypted, pwd)
+				}
+			}
+		})
+	}
+}
+
+// Passwords encrypted by keys which were rotated out of active must still be
+// decrypted, but never by another key
+func TestAesDecryptKeys(t *testing.T) {
+
+	setCryptoKeys(t, "k1:"+testKey1, "")
+	encrypted, err := AesEncrypt("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		keys    string
+		wantErr error
+	}{
+		{"rotated key", "k2:" + testKey2 + ",k1:" + testKey1, nil},
+		{"wrong key", "k1:" + testKey2, errors.New("message authentication failed")},
+		{"unknown key", "k2:" + testKey2, ErrUnknownEncryptionKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setCryptoKeys(t, tt.keys, "")
+
+			decrypted, err := AesDecrypt(encrypted)
+			if tt.wantErr == nil {
+				if err != nil || decrypted != "secret" {
+					t.Fatalf("decrypted %q, %v", decrypted, err)
+				}
+
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr.Error()) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAesDecryptLegacy(t *testing.T) {
+
+	// Legacy ciphertext does not need configured keys
+	setCryptoKeys(t, "", "")
+
+	for _, pwd := range []string{"secret", "", "sixteen byte pwd", "密碼"} {
+		decrypted, err := AesDecrypt(legacyAesEncrypt(t, pwd))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if decrypted != pwd {
+			t.Fatalf("decrypted %q, want %q", decrypted, pwd)
+		}
+	}
+}
+
+func TestAesMalformedInput(t *testing.T) {
+
+	setCryptoKeys(t, "k1:"+testKey1, "")
+
+	encrypted, err := AesEncrypt("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed := encrypted[len("v2:k1:"):]
+	tampered, err := base64.RawURLEncoding.DecodeString(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered[len(tampered)-1] ^= 1
+
+	keys := "k1:" + testKey1
+
+	tests := []struct {
+		name  string
+		keys  string
+		input string
+	}{
+		{"missing data", keys, "v2:k1"},
+		{"invalid base64", keys, "v2:k1:***"},
+		{"shorter than nonce", keys, "v2:k1:" + base64.RawURLEncoding.EncodeToString([]byte("short"))},
+		{"tampered data", keys, "v2:k1:" + base64.RawURLEncoding.EncodeToString(tampered)},
+		{"key id swapped", keys + ",k2:" + testKey1, "v2:k2:" + sealed},
+		{"legacy not hex", keys, "not a ciphertext"},
+		{"legacy not full block", keys, "00112233"},
+		{"legacy empty", keys, ""},
+		{"legacy invalid padding", keys, hex.EncodeToString(make([]byte, aes.BlockSize))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setCryptoKeys(t, tt.keys, "")
+
+			decrypted, err := AesDecrypt(tt.input)
+			if err == nil {
+				t.Fatalf("decrypted %q without error", decrypted)
+			}
+		})
+	}
+}
+
+func TestAesEncryptWithoutKey(t *testing.T) {
+
+	setCryptoKeys(t, "", "")
+
+	_, err := AesEncrypt("secret")
+	if !errors.Is(err, ErrNoEncryptionKey) {
+		t.Fatalf("err = %v, want %v", err, ErrNoEncryptionKey)
+	}
+}
+
+func TestLoadKeyRingInvalid(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		keys      string
+		activeKey string
+	}{
+		{"missing id", ":" + testKey1, ""},
+		{"missing separator", testKey1, ""},
+		{"invalid encoding", "k1:not-a-key", ""},
+		{"invalid size", "k1:00112233", ""},
+		{"unknown active key", "k1:" + testKey1, "k2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setCryptoKeys(t, tt.keys, tt.activeKey)
+
+			if _, err := loadKeyRing(); err == nil {
+				t.Fatal("invalid keys were accepted")
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package adapter
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const (
+	DefaultLagInterval       = 10
+	DefaultHeartbeatTable    = "gravity_heartbeat"
+	DefaultHeartbeatInterval = 10
+)
+
+type ReplicationLag struct {
+	Seconds        float64   `json:"seconds"`
+	Bytes          uint64    `json:"bytes"`
+	ReadPosition   string    `json:"readPosition"`
+	MasterPosition string    `json:"masterPosition"`
+	LastEventTime  time.Time `json:"lastEventTime"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+func (database *Database) updateProgress(pos mysql.Position, timestamp uint32) {
+	database.progressMu.Lock()
+	defer database.progressMu.Unlock()
+
+	if pos.Name != "" {
+		database.readPos = pos
+	}
+
+	if timestamp > 0 {
+		database.lastEventTime = time.Unix(int64(timestamp), 0)
+	}
+}
+
+func (database *Database) getProgress() (mysql.Position, time.Time) {
+	database.progressMu.RLock()
+	defer database.progressMu.RUnlock()
+	return database.readPos, database.lastEventTime
+}
+
+func (database *Database) GetReplicationLag() ReplicationLag {
+	database.progressMu.RLock()
+	defer database.progressMu.RUnlock()
+	return database.lag
+}
+
+func (database *Database) computeLag() (ReplicationLag, error) {
+
+	readPos, lastEventTime := database.getProgress()
+	lag := ReplicationLag{
+		ReadPosition:  readPos.String(),
+		LastEventTime: lastEventTime,
+		UpdatedAt:     time.Now(),
+	}
+
+	masterPos, err := database.GetCanalConnection().GetMasterPos()
+	if err != nil {
+		return lag, err
+	}
+
+	lag.MasterPosition = masterPos.String()
+
+	if readPos.Name == "" {
+		return lag, nil
+	}
+
+	// Nothing left to read
+	if readPos.Compare(masterPos) >= 0 {
+		return lag, nil
+	}
+
+	if !lastEventTime.IsZero() {
+		lag.Seconds = time.Since(lastEventTime).Seconds()
+	}
+
+	if readPos.Name == masterPos.Name {
+		lag.Bytes = uint64(masterPos.Pos - readPos.Pos)
+		return lag, nil
+	}
+
+	logs, err := database.getBinaryLogs()
+	if err != nil {
+		return lag, err
+	}
+
+	for _, binlog := range logs {
+		switch {
+		case binlog.Name == readPos.Name:
+			if binlog.Size > uint64(readPos.Pos) {
+				lag.Bytes += binlog.Size - uint64(readPos.Pos)
+			}
+		case binlog.Name == masterPos.Name:
+			lag.Bytes += uint64(masterPos.Pos)
+		case binlog.Name > readPos.Name && binlog.Name < masterPos.Name:
+			lag.Bytes += binlog.Size
+		}
+	}
+
+	return lag, nil
+}
+
+// monitorLag measures replication lag and keeps the heartbeat table updated
+func (database *Database) monitorLag() {
+
+	viper.SetDefault("source.lagInterval", DefaultLagInterval)
+	interval := time.Duration(viper.GetInt64("source.lagInterval")) * time.Second
+
+	heartbeat := database.source.info.Heartbeat
+	if heartbeat.Table == "" {
+		heartbeat.Table = DefaultHeartbeatTable
+	}
+
+	if heartbeat.Interval <= 0 {
+		heartbeat.Interval = DefaultHeartbeatInterval
+	}
+
+	if heartbeat.Enabled {
+		err := database.prepareHeartbeatTable(heartbeat.Table)
+		if err != nil {
+			log.Error("Failed to prepare heartbeat table: ", err)
+			heartbeat.Enabled = false
+		}
+	}
+
+	lagTicker := time.NewTicker(interval)
+	defer lagTicker.Stop()
+	heartbeatTicker := time.NewTicker(time.Duration(heartbeat.Interval) * time.Second)
+	defer heartbeatTicker.Stop()
+
+	for !database.stopping.Load() {
+		select {
+		case <-lagTicker.C:
+			lag, err := database.computeLag()
+			if err != nil {
+				log.Warn("Failed to compute replication lag: ", err)
+				continue
+			}
+
+			database.progressMu.Lock()
+			database.lag = lag
+			database.progressMu.Unlock()
+
+			lagSecondsGauge.WithLabelValues(database.source.name).Set(lag.Seconds)
+			lagBytesGauge.WithLabelValues(database.source.name).Set(float64(lag.Bytes))
+
+			log.WithFields(log.Fields{
+				"source":  database.source.name,
+				"seconds": lag.Seconds,
+				"bytes":   lag.Bytes,
+				"read":    lag.ReadPosition,
+				"master":  lag.MasterPosition,
+			}).Debug("Replication lag")
+
+		case <-heartbeatTicker.C:
+			if !heartbeat.Enabled {
+				continue
+			}
+
+			err := database.writeHeartbeat(heartbeat.Table)
+			if err != nil {
+				log.Warn("Failed to write heartbeat: ", err)
+			}
+		}
+	}
+}
+
+// Heartbeat statements are kept simple enough for statement-based binlogs
+func (database *Database) prepareHeartbeatTable(table string) error {
+
+	c := database.GetCanalConnection()
+	_, err := c.Execute(fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS `%s`.`%s` (id INT NOT NULL PRIMARY KEY, ts DATETIME NOT NULL)",
+		database.source.info.DBName,
+		table,
+	))
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Execute(fmt.Sprintf(
+		"INSERT IGNORE INTO `%s`.`%s` (id, ts) VALUES (1, UTC_TIMESTAMP())",
+		database.source.info.DBName,
+		table,
+	))
+	return err
+}
+
+func (database *Database) writeHeartbeat(table string) error {
+	_, err := database.GetCanalConnection().Execute(fmt.Sprintf(
+		"UPDATE `%s`.`%s` SET ts = UTC_TIMESTAMP() WHERE id = 1",
+		database.source.info.DBName,
+		table,
+	))
+	return err
+}
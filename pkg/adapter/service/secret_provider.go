@@ -0,0 +1,192 @@
+package adapter
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	SecretProviderFile  = "file"
+	SecretProviderEnv   = "env"
+	SecretProviderVault = "vault"
+)
+
+const DefaultVaultTimeout = 10
+
+var ErrSecretNotFound = errors.New("secret not found")
+
+// SecretRef describes where to get a credential from
+type SecretRef struct {
+	Type string `json:"type"`
+	Path string `json:"path"`
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+type SecretProvider interface {
+	GetSecret(ref *SecretRef) (string, error)
+}
+
+var secretProviders = map[string]SecretProvider{
+	SecretProviderFile:  &fileSecretProvider{},
+	SecretProviderEnv:   &envSecretProvider{},
+	SecretProviderVault: &vaultSecretProvider{},
+}
+
+func (ref *SecretRef) validate() []error {
+
+	errs := make([]error, 0)
+
+	switch ref.Type {
+	case SecretProviderFile, SecretProviderVault:
+		if len(ref.Path) == 0 {
+			errs = append(errs, errors.New(".path: required"))
+		}
+
+		if ref.Type == SecretProviderVault && len(ref.Key) == 0 {
+			errs = append(errs, errors.New(".key: required"))
+		}
+	case SecretProviderEnv:
+		if len(ref.Name) == 0 {
+			errs = append(errs, errors.New(".name: required"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf(".type: unknown secret provider \"%s\", must be one of file, env or vault", ref.Type))
+	}
+
+	return errs
+}
+
+func (ref *SecretRef) Resolve() (string, error) {
+
+	provider, ok := secretProviders[ref.Type]
+	if !ok {
+		return "", fmt.Errorf("Unknown secret provider \"%s\"", ref.Type)
+	}
+
+	return provider.GetSecret(ref)
+}
+
+// fileSecretProvider reads secret from file such as Kubernetes mounted secrets
+type fileSecretProvider struct {
+}
+
+func (provider *fileSecretProvider) GetSecret(ref *SecretRef) (string, error) {
+
+	data, err := os.ReadFile(ref.Path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+type envSecretProvider struct {
+}
+
+func (provider *envSecretProvider) GetSecret(ref *SecretRef) (string, error) {
+
+	value, ok := os.LookupEnv(ref.Name)
+	if !ok {
+		return "", fmt.Errorf("%s: %v", ref.Name, ErrSecretNotFound)
+	}
+
+	return value, nil
+}
+
+// vaultSecretProvider reads secret through HTTP API which is compatible with
+// KV secrets engine of HashiCorp Vault
+type vaultSecretProvider struct {
+}
+
+type vaultResponse struct {
+	Data   map[string]interface{} `json:"data"`
+	Errors []string               `json:"errors"`
+}
+
+func (provider *vaultSecretProvider) GetSecret(ref *SecretRef) (string, error) {
+
+	viper.SetDefault("vault.timeout", DefaultVaultTimeout)
+
+	address := viper.GetString("vault.address")
+	if address == "" {
+		return "", errors.New("vault.address is required by vault secret provider")
+	}
+
+	token, err := getVaultToken()
+	if err != nil {
+		return "", err
+	}
+
+	url := strings.TrimRight(address, "/") + "/v1/" + strings.TrimLeft(ref.Path, "/")
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("X-Vault-Token", token)
+	if namespace := viper.GetString("vault.namespace"); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+
+	client := &http.Client{
+		Timeout: time.Duration(viper.GetInt64("vault.timeout")) * time.Second,
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	var result vaultResponse
+	err = json.Unmarshal(body, &result)
+	if err != nil {
+		return "", fmt.Errorf("Failed to parse response of vault: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Failed to get secret from vault (%d): %s", resp.StatusCode, strings.Join(result.Errors, ", "))
+	}
+
+	// KV version 2 wraps secret in another data field
+	data := result.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		data = nested
+	}
+
+	value, ok := data[ref.Key].(string)
+	if !ok {
+		return "", fmt.Errorf("%s#%s: %v", ref.Path, ref.Key, ErrSecretNotFound)
+	}
+
+	return value, nil
+}
+
+func getVaultToken() (string, error) {
+
+	tokenFile := viper.GetString("vault.tokenFile")
+	if tokenFile == "" {
+		return viper.GetString("vault.token"), nil
+	}
+
+	// Token might be renewed by agent, so read it every time
+	data, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
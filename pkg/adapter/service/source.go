@@ -10,16 +10,16 @@ import (
 	"time"
 	"unsafe"
 
-	"github.com/BrobridgeOrg/broton"
-	"github.com/nats-io/nats.go"
 	"github.com/spf13/viper"
 
-	gravity_adapter "github.com/BrobridgeOrg/gravity-sdk/v2/adapter"
-	parallel_chunked_flow "github.com/cfsghost/parallel-chunked-flow"
+	"git.brobridge.com/gravity/gravity-adapter-mysql/pkg/connector"
+	"github.com/nats-io/nats.go"
 	log "github.com/sirupsen/logrus"
 )
 
-var counter uint64
+// PartialRowHeader is set on events from statement-based binlog, whose payload
+// only has columns referenced by the statement
+const PartialRowHeader = "Gravity-Partial-Row"
 
 type Packet struct {
 	EventName string
@@ -27,29 +27,43 @@ type Packet struct {
 }
 
 type Source struct {
-	adapter          *Adapter
-	info             *SourceInfo
-	store            *broton.Store
-	database         *Database
-	connector        *gravity_adapter.AdapterConnector
-	incoming         chan *CDCEvent
-	name             string
-	parser           *parallel_chunked_flow.ParallelChunkedFlow
-	tables           map[string]SourceTable
-	stopping         bool
-	mu               sync.Mutex
-	ackFutures       []nats.PubAckFuture
-	publishBatchSize uint64
-	rateLimiter      *rate.Limiter
+	adapter         *Adapter
+	info            *SourceInfo
+	checkpoints     CheckpointStore
+	database        *Database
+	publisher       *connector.Publisher
+	incoming        chan *CDCEvent
+	name            string
+	pipeline        *pipeline
+	tracker         *checkpointTracker
+	tables          map[string]SourceTable
+	stopping        atomic.Bool
+	mu              sync.Mutex
+	window          *publishWindow
+	deadLetters     *deadLetterQueue
+	claimChecks     nats.ObjectStore
+	published       uint64
+	rateLimiter     *rate.Limiter
+	checkpointMu    sync.RWMutex
+	checkpointGen   uint64
+	checkpointDirty bool
+	lastPosName     string
+	lastPos         uint32
+	persistMu       sync.Mutex
+	workers         sync.WaitGroup
+	done            chan struct{}
 }
 
 type Request struct {
+	seq       uint64
 	Pos       uint32
 	PosName   string
 	Req       *Packet
 	Table     string
 	Operation OperationType
 	EventPKs  string
+	EventID   string
+	Partial   bool
 }
 
 var dataPool = sync.Pool{
@@ -79,10 +93,12 @@ func StrToBytes(s string) []byte {
 }
 
 func NewSource(adapter *Adapter, name string, sourceInfo *SourceInfo) *Source {
-	viper.SetDefault("gravity.publishBatchSize", 1000)
-	publishBatchSize := viper.GetUint64("gravity.publishBatchSize")
-	viper.SetDefault("gravity.rateLimit", 0)
-	rateLimit := viper.GetFloat64("gravity.rateLimit")
+	// publishBatchSize is used as window size by older versions
+	viper.SetDefault("gravity.publishBatchSize", DefaultMaxInflight)
+	viper.SetDefault("gravity.maxInflight", viper.GetInt("gravity.publishBatchSize"))
+	viper.SetDefault("gravity.ackTimeout", DefaultAckTimeout)
+	maxInflight := orDefault(sourceInfo.Pipeline.MaxInflight, viper.GetInt("gravity.maxInflight"))
+	ackTimeout := time.Duration(viper.GetInt64("gravity.ackTimeout")) * time.Second
 
 	// required channel
 	if len(sourceInfo.Host) == 0 {
@@ -107,58 +123,64 @@ func NewSource(adapter *Adapter, name string, sourceInfo *SourceInfo) *Source {
 		tables[tableName] = config
 	}
 
-	limit := rate.Inf
-	if rateLimit != 0 {
-		limit = rate.Limit(rateLimit)
-	}
-	limiter := rate.NewLimiter(limit, int(rateLimit))
-	log.Info("Rate Limit: ", limiter.Limit())
+	limiter := sourceInfo.newRateLimiter()
+	log.WithFields(log.Fields{
+		"source": name,
+		"burst":  limiter.Burst(),
+	}).Info("Rate Limit: ", limiter.Limit())
 
 	source := &Source{
-		adapter:          adapter,
-		info:             sourceInfo,
-		store:            nil,
-		database:         NewDatabase(),
-		incoming:         make(chan *CDCEvent, 16),
-		name:             name,
-		tables:           tables,
-		stopping:         false,
-		ackFutures:       make([]nats.PubAckFuture, 0, publishBatchSize),
-		publishBatchSize: publishBatchSize,
-		rateLimiter:      limiter,
-	}
-
-	// Initialize parapllel chunked flow
-	pcfOpts := parallel_chunked_flow.Options{
-		BufferSize: 2048,
-		ChunkSize:  128,
-		ChunkCount: 16,
-		Handler: func(data interface{}, output func(interface{})) {
-			cdcEvent := data.(*CDCEvent)
-			defer cdcEventPool.Put(cdcEvent)
-
-			req := source.prepareRequest(cdcEvent)
-			if req == nil {
-				log.Warn("req in nil")
-				return
-			}
-			output(req)
-		},
+		adapter:     adapter,
+		info:        sourceInfo,
+		database:    NewDatabase(),
+		incoming:    make(chan *CDCEvent, orDefault(sourceInfo.Pipeline.Incoming, DefaultIncomingSize)),
+		name:        name,
+		tables:      tables,
+		rateLimiter: limiter,
+		done:        make(chan struct{}),
 	}
 
-	source.parser = parallel_chunked_flow.NewParallelChunkedFlow(&pcfOpts)
+	source.window = newPublishWindow(source, maxInflight, ackTimeout)
+	source.deadLetters = newDeadLetterQueue(source)
+
+	source.tracker = newCheckpointTracker(source)
+	source.pipeline = newPipeline(source,
+		orDefault(sourceInfo.Pipeline.Partitions, DefaultPartitions),
+		orDefault(sourceInfo.Pipeline.PartitionSize, DefaultPartitionSize),
+	)
 
 	return source
 }
 
 func (source *Source) Uninit() error {
-	fmt.Println("Stopping ...")
-	source.stopping = true
+	log.WithFields(log.Fields{
+		"source": source.name,
+	}).Info("Stopping ...")
+
+	source.stopping.Store(true)
 	source.database.Uninit()
 	time.Sleep(1 * time.Second)
 
 	source.checkPublishAsyncComplete()
-	source.adapter.storeMgr.Close()
+
+	close(source.done)
+	source.deadLetters.close()
+
+	// Reaper and flusher stop on done, the last checkpoint is written after
+	// them so nothing uses the store once it was closed
+	source.workers.Wait()
+
+	if source.checkpoints != nil {
+		err := source.flushCheckpoint()
+		if err != nil {
+			log.WithFields(log.Fields{
+				"source": source.name,
+			}).Error("Failed to save checkpoint: ", err)
+		}
+
+		source.checkpoints.Close()
+	}
+
 	return nil
 
 }
@@ -182,6 +204,8 @@ func (source *Source) parseEventName(event *CDCEvent) string {
 		eventName = tableInfo.Events.Delete
 	case SnapshotOperation:
 		eventName = tableInfo.Events.Snapshot
+	case TruncateOperation:
+		eventName = tableInfo.Events.Truncate
 	default:
 		return eventName
 	}
@@ -191,80 +215,69 @@ func (source *Source) parseEventName(event *CDCEvent) string {
 
 func (source *Source) Init() error {
 
-	if viper.GetBool("store.enabled") {
-
-		// Initializing store
-		log.WithFields(log.Fields{
-			"store": "adapter-" + source.name,
-		}).Info("Initializing store for adapter")
-		store, err := source.adapter.storeMgr.GetStore("adapter-" + source.name)
-		if err != nil {
-			return err
-		}
+	// Initializing gravity adapter connector
+	publisher, err := source.adapter.app.NewPublisher()
+	if err != nil {
+		return err
+	}
 
-		source.store = store
+	source.publisher = publisher
 
-		var lastPos uint64 = 0
-		var lastPosName string = ""
+	checkpoints, err := newCheckpointStore(source)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
 
-		// Register columns
-		columns := []string{"status"}
-		err = source.store.RegisterColumns(columns)
-		if err != nil {
-			log.Error(err)
-			return err
-		}
+	if checkpoints != nil {
+		source.checkpoints = checkpoints
 
-		// Getting last Position Name
-		posnameCol := fmt.Sprintf("%s-POSNAME", source.name)
-		lastPosName, err = source.store.GetString("status", []byte(posnameCol))
+		// Getting last position
+		lastPosName, lastPos, err := source.checkpoints.GetPosition()
 		if err != nil {
 			log.Error(err)
 			return err
 		}
 
-		// Getting last Position
-		posCol := fmt.Sprintf("%s-POS", source.name)
-		lastPos, err = source.store.GetUint64("status", []byte(posCol))
-		if err != nil {
-			log.Error(err)
-			return err
-		}
 		for tableName, _ := range source.tables {
-			// set  default values
-			var initialLoadStatus int64 = 0
-			initialLoadStatusCol := fmt.Sprintf("%s-%s-initialload", source.name, tableName)
-			initialLoadStatus, err = source.store.GetInt64("status", []byte(initialLoadStatusCol))
+			initialLoaded, err := source.checkpoints.GetInitialLoaded(tableName)
 			if err != nil {
 				log.Error(err)
 				return err
 			}
 
-			tableInfo := source.database.tableInfo[tableName]
-			if initialLoadStatus != 0 {
-				tableInfo.initialLoaded = true
-			} else {
-				tableInfo.initialLoaded = false
-			}
-			source.database.tableInfo[tableName] = tableInfo
+			source.database.setTableInfo(tableName, tableInfo{
+				initialLoaded: initialLoaded,
+			})
 		}
 
 		source.database.lastPosName = lastPosName
-		source.database.lastPos = uint32(lastPos)
-
+		source.database.lastPos = lastPos
+		source.setCheckpoint(lastPosName, lastPos)
 	}
 
-	// Initializing gravity adapter connector
-	source.connector = source.adapter.app.GetAdapterConnector()
-
 	// Connect to database
-	err := source.database.Connect(source)
+	err = source.database.Connect(source)
 	if err != nil {
 		return err
 	}
 
+	source.pipeline.start()
 	go source.eventReceiver()
-	go source.requestHandler()
+
+	source.workers.Add(1)
+	go func() {
+		defer source.workers.Done()
+		source.window.run()
+	}()
+
+	if source.checkpoints != nil {
+		source.workers.Add(1)
+		go func() {
+			defer source.workers.Done()
+			source.checkpointFlusher()
+		}()
+	}
 
 	// Getting tables
 	tables := make([]string, 0, len(source.tables))
@@ -277,15 +290,7 @@ func (source *Source) Init() error {
 	}).Info("Preparing to watch tables")
 
 	go func(tables []string, initialLoad bool) {
-		err = source.database.StartCDC(tables, initialLoad, func(event *CDCEvent) {
-			/*
-				req := source.prepareRequest(event)
-				if req == nil {
-					return
-				}
-			*/
-			source.incoming <- event
-		})
+		err = source.database.StartCDC(tables, initialLoad, source.pushEvent)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -294,6 +299,16 @@ func (source *Source) Init() error {
 	return nil
 }
 
+func (source *Source) pushEvent(event *CDCEvent) {
+
+	event.generation = source.checkpointGeneration()
+
+	select {
+	case source.incoming <- event:
+	case <-source.done:
+	}
+}
+
 func (source *Source) eventReceiver() {
 
 	log.WithFields(log.Fields{
@@ -303,36 +318,34 @@ func (source *Source) eventReceiver() {
 
 	for {
 		select {
-		case msg := <-source.incoming:
-			for {
-				err := source.parser.Push(msg)
-				if err != nil {
-					log.Trace(err, ", retry ...")
-					time.Sleep(10 * time.Millisecond)
-					continue
-				}
-				break
+		case event := <-source.incoming:
+			if source.stopping.Load() {
+				releaseCDCEvent(event)
+				continue
 			}
+
+			source.pipeline.push(event)
+		case <-source.done:
+			return
 		}
 	}
 }
 
-func (source *Source) requestHandler() {
+// processEvent is called by partition of pipeline which event belongs to
+func (source *Source) processEvent(event *CDCEvent, seq uint64) {
 
-	for {
-		select {
-		case req := <-source.parser.Output():
-			// TODO: retry
-			/*
-				if req == nil {
-					break
-				}
-			*/
-			request := req.(*Request)
-			source.HandleRequest(request)
-			requestPool.Put(request)
-		}
+	request := source.prepareRequest(event)
+	releaseCDCEvent(event)
+
+	if request == nil {
+		// Nothing to publish, but checkpoint can still move
+		source.tracker.done(seq)
+		return
 	}
+
+	request.seq = seq
+	source.HandleRequest(request)
+	requestPool.Put(request)
 }
 
 func (source *Source) prepareRequest(event *CDCEvent) *Request {
@@ -348,6 +361,12 @@ func (source *Source) prepareRequest(event *CDCEvent) *Request {
 	// Prepare payload
 	data := dataPool.Get().(map[string]interface{})
 	defer dataPool.Put(data)
+
+	// Columns of previous rows must not be published with this one
+	for k := range data {
+		delete(data, k)
+	}
+
 	for k, v := range event.Before {
 
 		data[k] = v
@@ -371,120 +390,258 @@ func (source *Source) prepareRequest(event *CDCEvent) *Request {
 	request.Table = event.Table
 	request.Operation = event.Operation
 	request.EventPKs = event.EventPKs
+	request.EventID = event.EventID
+	request.Partial = event.Partial
 
 	request.Req.EventName = eventName
+
+	if limit := source.messageLimit(); limit > 0 {
+		payload, err = source.shrinkPayload(request, limit, data, payload)
+		if err != nil {
+			log.Error(err)
+			requestPool.Put(request)
+			return nil
+		}
+	}
+
 	request.Req.Payload = payload
 
 	return request
 }
 
+// setMeta sets headers of message which carries request
+func (source *Source) setMeta(request *Request, meta map[string]string) {
+
+	meta["Nats-Msg-Id"] = request.msgID(source.name)
+	if request.Partial {
+		meta[PartialRowHeader] = "true"
+	} else {
+		delete(meta, PartialRowHeader)
+	}
+}
+
+// msgID is used by server to drop events which were published already
+func (request *Request) msgID(sourceName string) string {
+
+	if request.Operation == SnapshotOperation {
+		if request.EventID != "" {
+			return fmt.Sprintf("%s-%s-%s-snapshot", sourceName, request.Table, request.EventID)
+		}
+
+		return fmt.Sprintf("%s-%s-%d-snapshot", sourceName, request.Table, request.Pos)
+	}
+
+	return fmt.Sprintf("%s-%s-%s", sourceName, request.Table, request.EventID)
+}
+
 func (source *Source) HandleRequest(request *Request) {
 
-	if source.stopping {
+	if source.stopping.Load() {
 		time.Sleep(time.Second)
 		return
 	}
 
 	meta := metaPool.Get().(map[string]string)
-	if request.Operation != SnapshotOperation {
-		meta["Nats-Msg-Id"] = fmt.Sprintf("%s-%s-%s", source.name, request.Table, request.EventPKs)
-	} else {
-		meta["Nats-Msg-Id"] = fmt.Sprintf("%s-%s-%d-snapshot", source.name, request.Table, request.Pos)
-	}
+	source.setMeta(request, meta)
 	log.Trace("Nats-Msg-Id: ", meta["Nats-Msg-Id"])
-	for {
+	for retries := 0; ; {
 		// Using new SDK to re-implement this part
 		source.rateLimiter.Wait(context.Background())
-		future, err := source.connector.PublishAsync(request.Req.EventName, request.Req.Payload, meta)
+
+		// Blocks until there is room in the window and no message is being
+		// sent again
+		if !source.window.acquire() {
+			metaPool.Put(meta)
+			return
+		}
+
+		future, err := source.publisher.PublishAsync(request.Req.EventName, request.Req.Payload, meta)
 		if err != nil {
+			source.window.release()
+			publishErrorsCounter.WithLabelValues(source.name, request.Table).Inc()
+
+			// Rejected events must not stall replication
+			if source.deadLetters.accepts(err, retries) {
+				source.deadLetters.put(&DeadLetter{
+					Table:       request.Table,
+					EventName:   request.Req.EventName,
+					MsgID:       meta["Nats-Msg-Id"],
+					PosName:     request.PosName,
+					Pos:         request.Pos,
+					Retries:     retries,
+					PayloadSize: len(request.Req.Payload),
+					Payload:     request.Req.Payload,
+				}, err)
+				source.tracker.done(request.seq)
+				metaPool.Put(meta)
+				return
+			}
+
 			log.Error("Failed to get publish Request:", err)
 			log.Debug("EventName: ", request.Req.EventName, " Payload: ", string(request.Req.Payload))
+
+			// Unavailability of server does not count against maxRetries
+			if !isTransientError(err) {
+				retries++
+			}
+
 			time.Sleep(time.Second)
 			//return
 			continue
 		}
-		source.ackFutures = append(source.ackFutures, future)
+
+		source.window.push(&inflightMsg{
+			future:      future,
+			publishedAt: time.Now(),
+			posName:     request.PosName,
+			pos:         request.Pos,
+			seq:         request.seq,
+			table:       request.Table,
+			eventName:   request.Req.EventName,
+			payload:     request.Req.Payload,
+		})
+		eventsCounter.WithLabelValues(source.name, request.Table, request.Operation.String()).Inc()
+		publishedBytesCounter.WithLabelValues(source.name, request.Table).Add(float64(len(request.Req.Payload)))
 
 		log.Debug("EventName: ", request.Req.EventName)
 		log.Trace("Payload: ", string(request.Req.Payload))
-		log.Debug("Total amount: ", atomic.AddUint64((*uint64)(&counter), 1))
+		log.Debug("Total amount: ", atomic.AddUint64(&source.published, 1))
 
 		metaPool.Put(meta)
 		break
 	}
+}
 
-	for source.store != nil && request.Operation != SnapshotOperation {
-		//posCol := fmt.Sprintf("%s-POS", source.name)
-		posCol := source.name + "-POS"
-		err := source.store.PutUint64("status", []byte(posCol), uint64(request.Pos))
-		if err != nil {
-			log.Error("Failed to update Position")
-			time.Sleep(time.Second)
-			continue
-		}
+// commitCheckpoint records position of which all events before were
+// acknowledged, it is written to store by checkpointFlusher. Events which were
+// read before checkpoint was reset belong to an older generation, and never
+// move it.
+func (source *Source) commitCheckpoint(posName string, pos uint32, generation uint64) {
+	source.advanceCheckpoint(posName, pos, generation)
+}
 
-		//posnameCol := fmt.Sprintf("%s-POSNAME", source.name)
-		posnameCol := source.name + "-POSNAME"
-		err = source.store.PutString("status", []byte(posnameCol), request.PosName)
-		if err != nil {
-			log.Error("Failed to update Position Name")
-			time.Sleep(time.Second)
-			continue
-		}
-		break
+// checkpointFlusher writes checkpoint to store periodically, so store is not
+// written for every acknowledged event
+func (source *Source) checkpointFlusher() {
+
+	viper.SetDefault("checkpoint.flushInterval", DefaultCheckpointFlushInterval)
+	interval := time.Duration(viper.GetFloat64("checkpoint.flushInterval") * float64(time.Second))
+	if interval <= 0 {
+		interval = DefaultCheckpointFlushInterval * time.Second
 	}
 
-	if atomic.LoadUint64((*uint64)(&counter))%source.publishBatchSize == 0 {
-		lastFuture := 0
-		isError := false
-	RETRY:
-		for i, future := range source.ackFutures {
-			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-			select {
-			case <-future.Ok():
-				//log.Infof("Message %d acknowledged: %+v", i, pubAck)
-			case <-ctx.Done():
-				log.Warnf("Failed to publish message, retry ...")
-				lastFuture = i
-				isError = true
-				cancel()
-				break RETRY
-			}
-			cancel()
-		}
-		if isError {
-			source.connector.GetJetStream().CleanupPublisher()
-			log.Trace("start retry ...  ", len(source.ackFutures[lastFuture:]))
-			for _, future := range source.ackFutures[lastFuture:] {
-				// send msg with Sync mode
-				for {
-					_, err := source.connector.GetJetStream().PublishMsg(future.Msg())
-					if err != nil {
-						log.Warn(err, ", retry ...")
-						time.Sleep(time.Second)
-						continue
-					}
-					break
-				}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := source.flushCheckpoint()
+			if err != nil {
+				log.WithFields(log.Fields{
+					"source": source.name,
+				}).Error("Failed to save checkpoint: ", err)
 			}
-			log.Trace("retry done")
+		case <-source.done:
+			return
 		}
-		source.ackFutures = source.ackFutures[:0]
+	}
+}
+
+// flushCheckpoint writes checkpoint to store if it was moved
+func (source *Source) flushCheckpoint() error {
+
+	source.persistMu.Lock()
+	defer source.persistMu.Unlock()
+
+	source.checkpointMu.RLock()
+	dirty := source.checkpointDirty
+	posName := source.lastPosName
+	pos := source.lastPos
+	source.checkpointMu.RUnlock()
+
+	if !dirty || source.checkpoints == nil {
+		return nil
+	}
+
+	err := source.persistCheckpoint(posName, pos)
+	if err != nil {
+		return err
+	}
+
+	// It may have been moved again while it was written
+	source.checkpointMu.Lock()
+	if source.lastPosName == posName && source.lastPos == pos {
+		source.checkpointDirty = false
+	}
+	source.checkpointMu.Unlock()
+
+	return nil
+}
+
+func (source *Source) setCheckpoint(posName string, pos uint32) {
+	source.checkpointMu.Lock()
+	defer source.checkpointMu.Unlock()
+	source.lastPosName = posName
+	source.lastPos = pos
+}
+
+func (source *Source) advanceCheckpoint(posName string, pos uint32, generation uint64) bool {
+	source.checkpointMu.Lock()
+	defer source.checkpointMu.Unlock()
+
+	if generation != source.checkpointGen {
+		return false
+	}
+
+	source.lastPosName = posName
+	source.lastPos = pos
+	source.checkpointDirty = true
+
+	return true
+}
+
+func (source *Source) checkpointGeneration() uint64 {
+	source.checkpointMu.RLock()
+	defer source.checkpointMu.RUnlock()
+	return source.checkpointGen
+}
+
+func (source *Source) persistCheckpoint(posName string, pos uint32) error {
+	return source.checkpoints.PutPosition(posName, pos)
+}
+
+func (source *Source) getCheckpoint() (string, uint32) {
+	source.checkpointMu.RLock()
+	defer source.checkpointMu.RUnlock()
+	return source.lastPosName, source.lastPos
+}
+
+// resumeFrom takes over checkpoint and initial load status of source which was
+// stopped, so a restarted source neither loses events nor loads tables again
+// when checkpoints are not persisted. Checkpoint store overrides them in Init.
+func (source *Source) resumeFrom(previous *Source) {
+
+	posName, pos := previous.getCheckpoint()
+	if posName == "" {
+		// Nothing was acknowledged, so it resumes from where previous started
+		posName, pos = previous.database.lastPosName, previous.database.lastPos
+	}
+
+	if posName != "" {
+		source.database.lastPosName = posName
+		source.database.lastPos = pos
+		source.setCheckpoint(posName, pos)
+	}
+
+	for tableName := range source.tables {
+		source.database.setTableInfo(tableName, previous.database.getTableInfo(tableName))
 	}
 }
 
 func (source *Source) checkPublishAsyncComplete() {
 	// timeout 60s
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-	defer cancel()
-	select {
-	case <-source.connector.PublishAsyncComplete():
-		//log.Info("All messages acknowledged.")
-	case <-ctx.Done():
-		// if the context timeout or canceled, ctx.Done() will return.
-		if ctx.Err() == context.DeadlineExceeded {
-			log.Error("Timeout waiting for acknowledgements. AsyncPending: ", source.connector.GetJetStream().PublishAsyncPending())
-		}
+	if !source.window.wait(60 * time.Second) {
+		log.Error("Timeout waiting for acknowledgements. AsyncPending: ", source.window.Len())
 	}
-
 }
@@ -0,0 +1,164 @@
+package adapter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Matches $${NAME} (escaped), ${NAME} and ${NAME:-default}
+var envPattern = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)(:-[^}]*)?\}`)
+
+// expandEnv replaces ${NAME} with value of environment variable. It only
+// works on a single value, so a variable never changes structure of config.
+func expandEnv(value string) (string, error) {
+
+	undefined := make([]string, 0)
+
+	result := envPattern.ReplaceAllStringFunc(value, func(match string) string {
+
+		// $${NAME} is left as ${NAME}
+		if strings.HasPrefix(match, "$$") {
+			return match[1:]
+		}
+
+		groups := envPattern.FindStringSubmatch(match)
+		name := groups[1]
+
+		value, ok := os.LookupEnv(name)
+		if ok && value != "" {
+			return value
+		}
+
+		if len(groups[2]) > 0 {
+			return groups[2][2:]
+		}
+
+		if !ok {
+			undefined = append(undefined, name)
+		}
+
+		return value
+	})
+
+	if len(undefined) > 0 {
+		return "", fmt.Errorf("undefined environment variables: %s", strings.Join(undefined, ", "))
+	}
+
+	return result, nil
+}
+
+// expandConfigEnv expands environment variables in string values of parsed
+// config. A value which references variables is converted to number or bool
+// if field of t it is decoded into has that type, e.g. port: ${DB_PORT}.
+func expandConfigEnv(prefix string, raw interface{}, t reflect.Type) (interface{}, error) {
+
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch v := raw.(type) {
+	case map[string]interface{}:
+		var fields map[string]reflect.Type
+		if t != nil && t.Kind() == reflect.Struct {
+			fields = jsonFields(t)
+		}
+
+		for _, key := range sortedKeys(v) {
+			var fieldType reflect.Type
+			if fields != nil {
+				fieldType = fields[key]
+			} else if t != nil && t.Kind() == reflect.Map {
+				fieldType = t.Elem()
+			}
+
+			value, err := expandConfigEnv(prefix+key+".", v[key], fieldType)
+			if err != nil {
+				return nil, err
+			}
+
+			v[key] = value
+		}
+
+		return v, nil
+	case []interface{}:
+		var elemType reflect.Type
+		if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+			elemType = t.Elem()
+		}
+
+		for i := range v {
+			value, err := expandConfigEnv(fmt.Sprintf("%s%d.", prefix, i), v[i], elemType)
+			if err != nil {
+				return nil, err
+			}
+
+			v[i] = value
+		}
+
+		return v, nil
+	case string:
+		value, err := expandEnv(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", strings.TrimSuffix(prefix, "."), err)
+		}
+
+		if value == v || t == nil {
+			return value, nil
+		}
+
+		typed, err := convertEnvValue(value, t.Kind())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", strings.TrimSuffix(prefix, "."), err)
+		}
+
+		return typed, nil
+	}
+
+	return raw, nil
+}
+
+func convertEnvValue(value string, kind reflect.Kind) (interface{}, error) {
+
+	switch kind {
+	case reflect.Bool:
+		return strconv.ParseBool(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.ParseInt(value, 10, 64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.ParseUint(value, 10, 64)
+	case reflect.Float32, reflect.Float64:
+		return strconv.ParseFloat(value, 64)
+	}
+
+	return value, nil
+}
+
+func convertToJSON(filename string, data []byte) ([]byte, error) {
+
+	var raw map[string]interface{}
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		err := yaml.Unmarshal(data, &raw)
+		if err != nil {
+			return nil, err
+		}
+	case ".toml":
+		err := toml.Unmarshal(data, &raw)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return data, nil
+	}
+
+	return json.Marshal(raw)
+}
@@ -0,0 +1,96 @@
+package adapter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExpandEnv(t *testing.T) {
+
+	t.Setenv("ADAPTER_TEST_HOST", "db.example.com")
+	t.Setenv("ADAPTER_TEST_EMPTY", "")
+
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"plain value", "localhost", "localhost", false},
+		{"variable", "${ADAPTER_TEST_HOST}", "db.example.com", false},
+		{"inside value", "tcp://${ADAPTER_TEST_HOST}:3306", "tcp://db.example.com:3306", false},
+		{"default of unset variable", "${ADAPTER_TEST_UNSET:-3306}", "3306", false},
+		{"default of empty variable", "${ADAPTER_TEST_EMPTY:-3306}", "3306", false},
+		{"empty variable", "${ADAPTER_TEST_EMPTY}", "", false},
+		{"escaped", "$${ADAPTER_TEST_HOST}", "${ADAPTER_TEST_HOST}", false},
+		{"undefined", "${ADAPTER_TEST_UNSET}", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandEnv(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Fatalf("expandEnv(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadSourceConfigEnv(t *testing.T) {
+
+	t.Setenv("ADAPTER_TEST_HOST", "db.example.com")
+	t.Setenv("ADAPTER_TEST_PORT", "3307")
+	t.Setenv("ADAPTER_TEST_PASSWORD", "p\"a'ss\n  word: x # not a comment")
+
+	tests := []struct {
+		name     string
+		filename string
+		content  string
+		wantErr  bool
+	}{
+		{"json", "sources.json", `{"sources": {"s1": {"host": "${ADAPTER_TEST_HOST}", "port": "${ADAPTER_TEST_PORT}", "password": "${ADAPTER_TEST_PASSWORD}", "dbname": "db"}}}`, false},
+		{"yaml", "sources.yaml", "sources:\n  s1:\n    host: ${ADAPTER_TEST_HOST}\n    port: ${ADAPTER_TEST_PORT}\n    password: ${ADAPTER_TEST_PASSWORD}\n    dbname: db\n", false},
+		{"toml", "sources.toml", "[sources.s1]\nhost = \"${ADAPTER_TEST_HOST}\"\nport = \"${ADAPTER_TEST_PORT}\"\npassword = \"${ADAPTER_TEST_PASSWORD}\"\ndbname = \"db\"\n", false},
+		{"invalid number", "sources.yaml", "sources:\n  s1:\n    host: ${ADAPTER_TEST_HOST}\n    port: ${ADAPTER_TEST_HOST}\n", true},
+		{"undefined", "sources.yaml", "sources:\n  s1:\n    host: ${ADAPTER_TEST_UNSET}\n", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), tt.filename)
+			err := os.WriteFile(filename, []byte(tt.content), 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sm := &SourceManager{}
+			config, err := sm.LoadSourceConfig(filename)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			info := config.Sources["s1"]
+			if info.Host != "db.example.com" || info.Port != 3307 || info.DBName != "db" {
+				t.Fatalf("unexpected source %+v", info)
+			}
+
+			// Value of variable must not change structure of config
+			if info.Password != os.Getenv("ADAPTER_TEST_PASSWORD") {
+				t.Fatalf("password = %q", info.Password)
+			}
+
+			if len(config.unknownKeys) != 0 {
+				t.Fatalf("unknown keys %v", config.unknownKeys)
+			}
+		})
+	}
+}
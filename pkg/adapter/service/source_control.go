@@ -0,0 +1,156 @@
+package adapter
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrSourceNotFound     = errors.New("source not found")
+	ErrTableNotFound      = errors.New("table not found")
+	ErrSourceNotPaused    = errors.New("source must be paused first")
+	ErrSnapshotInProgress = errors.New("snapshot is in progress")
+	ErrReaderNotStopped   = errors.New("binlog reader is still stopping")
+)
+
+// readerStopTimeout is how long ResetCheckpoint waits for binlog reader of
+// paused source to stop
+const readerStopTimeout = 5 * time.Second
+
+type Checkpoint struct {
+	PosName     string          `json:"posName"`
+	Pos         uint32          `json:"pos"`
+	InitialLoad map[string]bool `json:"initialLoad"`
+}
+
+func (source *Source) Pause() {
+
+	source.database.Pause()
+
+	log.WithFields(log.Fields{
+		"source": source.name,
+	}).Info("Source was paused")
+}
+
+func (source *Source) Resume() {
+
+	source.database.Resume()
+
+	log.WithFields(log.Fields{
+		"source": source.name,
+	}).Info("Source was resumed")
+}
+
+// ResnapshotTable takes snapshot of table again in background
+func (source *Source) ResnapshotTable(table string) error {
+
+	if _, ok := source.tables[table]; !ok {
+		return ErrTableNotFound
+	}
+
+	// Only one snapshot at a time
+	if !atomic.CompareAndSwapInt32(&source.database.snapshotting, 0, 1) {
+		return ErrSnapshotInProgress
+	}
+
+	log.WithFields(log.Fields{
+		"source": source.name,
+		"table":  table,
+	}).Info("Taking snapshot of table again")
+
+	go func() {
+		defer atomic.AddInt32(&source.database.snapshotting, -1)
+
+		err := source.database.Resnapshot([]string{table}, source.pushEvent)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"source": source.name,
+				"table":  table,
+			}).Error("Failed to take snapshot: ", err)
+		}
+	}()
+
+	return nil
+}
+
+func (source *Source) GetCheckpoint() Checkpoint {
+
+	checkpoint := Checkpoint{
+		InitialLoad: make(map[string]bool, len(source.tables)),
+	}
+
+	checkpoint.PosName, checkpoint.Pos = source.getCheckpoint()
+
+	for tableName, _ := range source.tables {
+		checkpoint.InitialLoad[tableName] = source.database.getTableInfo(tableName).initialLoaded
+	}
+
+	return checkpoint
+}
+
+// ResetCheckpoint moves the position which binlog reader resumes from.
+// The current position of master is used if posName is empty.
+//
+// Events which were read before are still published, but generation of
+// checkpoint changes so their acknowledgements no longer move it.
+func (source *Source) ResetCheckpoint(posName string, pos uint32) error {
+
+	if !source.database.isPaused() {
+		return ErrSourceNotPaused
+	}
+
+	// No event may be read while generation changes
+	if atomic.LoadInt32(&source.database.snapshotting) > 0 {
+		return ErrSnapshotInProgress
+	}
+
+	if !source.database.waitReaderState(BinlogReaderPaused, readerStopTimeout) {
+		return ErrReaderNotStopped
+	}
+
+	if posName == "" {
+		masterPos, err := source.database.GetCanalConnection().GetMasterPos()
+		if err != nil {
+			return err
+		}
+
+		posName = masterPos.Name
+		pos = masterPos.Pos
+	}
+
+	source.persistMu.Lock()
+	defer source.persistMu.Unlock()
+
+	if source.checkpoints != nil {
+		err := source.persistCheckpoint(posName, pos)
+		if err != nil {
+			return err
+		}
+	}
+
+	source.checkpointMu.Lock()
+	source.checkpointGen++
+	source.lastPosName = posName
+	source.lastPos = pos
+	source.checkpointDirty = false
+	source.checkpointMu.Unlock()
+
+	log.WithFields(log.Fields{
+		"source":  source.name,
+		"posName": posName,
+		"pos":     pos,
+	}).Warn("Checkpoint was reset")
+
+	return nil
+}
+
+func (adapter *Adapter) GetSource(name string) (*Source, error) {
+	return adapter.sm.GetSource(name)
+}
+
+func (adapter *Adapter) ReloadSource(name string) error {
+	return adapter.sm.ReloadSource(name)
+}
@@ -4,25 +4,45 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"reflect"
 	"strings"
+	"sync"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
 type SourceConfig struct {
-	Sources map[string]SourceInfo `json:"sources"`
+	Sources     map[string]SourceInfo `json:"sources"`
+	unknownKeys []string
 }
 
 type SourceInfo struct {
-	Disabled    bool                   `json:"disabled"`
-	InitialLoad bool                   `json:"initialLoad"`
-	Host        string                 `json:"host"`
-	Port        int                    `json:"port"`
-	Username    string                 `json:"username"`
-	Password    string                 `json:"password"`
-	DBName      string                 `json:"dbname"`
-	Tables      map[string]SourceTable `json:"tables"`
+	Disabled           bool                   `json:"disabled"`
+	InitialLoad        bool                   `json:"initialLoad"`
+	Host               string                 `json:"host"`
+	Port               int                    `json:"port"`
+	Username           string                 `json:"username"`
+	Password           string                 `json:"password"`
+	UsernameFrom       *SecretRef             `json:"usernameFrom"`
+	PasswordFrom       *SecretRef             `json:"passwordFrom"`
+	TLS                SourceTLS              `json:"tls"`
+	DBName             string                 `json:"dbname"`
+	TruncateOnDrop     bool                   `json:"truncateOnDrop"`
+	BinlogPurgedPolicy string                 `json:"binlogPurgedPolicy"`
+	Heartbeat          SourceHeartbeat        `json:"heartbeat"`
+	MaxMessageSize     int                    `json:"maxMessageSize"`
+	Oversize           SourceOversize         `json:"oversize"`
+	Pipeline           SourcePipeline         `json:"pipeline"`
+	RateLimit          *float64               `json:"rateLimit"`
+	RateBurst          int                    `json:"rateBurst"`
+	Tables             map[string]SourceTable `json:"tables"`
+}
+
+type SourceHeartbeat struct {
+	Enabled  bool   `json:"enabled"`
+	Table    string `json:"table"`
+	Interval int    `json:"interval"`
 }
 
 type SourceTable struct {
@@ -34,17 +54,24 @@ type SourceTableEvents struct {
 	Create   string `json:"create"`
 	Update   string `json:"update"`
 	Delete   string `json:"delete"`
+	Truncate string `json:"truncate"`
 }
 
 type SourceManager struct {
-	adapter *Adapter
-	sources map[string]*Source
+	adapter  *Adapter
+	sources  map[string]*Source
+	infos    map[string]SourceInfo
+	mu       sync.RWMutex
+	reloadMu sync.Mutex
+	done     chan struct{}
 }
 
 func NewSourceManager(adapter *Adapter) *SourceManager {
 	return &SourceManager{
 		adapter: adapter,
 		sources: make(map[string]*Source),
+		infos:   make(map[string]SourceInfo),
+		done:    make(chan struct{}),
 	}
 }
 
@@ -56,6 +83,11 @@ func (sm *SourceManager) Initialize() error {
 		return err
 	}
 
+	err = config.Validate()
+	if err != nil {
+		return err
+	}
+
 	// Initializing sources
 	for name, info := range config.Sources {
 
@@ -63,71 +95,299 @@ func (sm *SourceManager) Initialize() error {
 			continue
 		}
 
-		log.WithFields(log.Fields{
-			"name": name,
-			"host": info.Host,
-			"port": info.Port,
-			//"mode": info.Mode,
-		}).Info("Initializing source")
-
-		pwdFromEnvKey := fmt.Sprintf("%s_PASSWORD", strings.ToUpper(name))
-		pwdFromEnvValue := os.Getenv(pwdFromEnvKey)
-		if pwdFromEnvValue != "" {
-			pwd, err := AesDecrypt(pwdFromEnvValue)
-			if err != nil {
-				log.Error(err)
-				return err
-			}
-
-			info.Password = pwd
+		source, err := sm.startSource(name, info, nil)
+		if err != nil {
+			return err
 		}
 
-		sourceInfo := info
-		source := NewSource(sm.adapter, name, &sourceInfo)
-		err := source.Init()
+		sm.mu.Lock()
+		sm.sources[name] = source
+		sm.infos[name] = info
+		sm.mu.Unlock()
+	}
+
+	go sm.watchConfig()
+
+	return nil
+}
+
+// startSource takes over progress of previous source if it is restarted
+func (sm *SourceManager) startSource(name string, info SourceInfo, previous *Source) (*Source, error) {
+
+	log.WithFields(log.Fields{
+		"name": name,
+		"host": info.Host,
+		"port": info.Port,
+		//"mode": info.Mode,
+	}).Info("Initializing source")
+
+	err := resolveCredentials(name, &info)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	source := NewSource(sm.adapter, name, &info)
+	if source == nil {
+		return nil, fmt.Errorf("Invalid configuration of source \"%s\"", name)
+	}
+
+	if previous != nil {
+		source.resumeFrom(previous)
+	}
+
+	err = source.Init()
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	return source, nil
+}
+
+// resolveCredentials takes username and password from secret providers, or
+// encrypted password from environment variable if it exists
+func resolveCredentials(name string, info *SourceInfo) error {
+
+	pwdFromEnvKey := fmt.Sprintf("%s_PASSWORD", strings.ToUpper(name))
+	pwdFromEnvValue := os.Getenv(pwdFromEnvKey)
+	if pwdFromEnvValue != "" {
+		pwd, err := AesDecrypt(pwdFromEnvValue)
 		if err != nil {
-			log.Error(err)
 			return err
 		}
 
-		sm.sources[name] = source
+		info.Password = pwd
+	}
+
+	if info.UsernameFrom != nil {
+		username, err := info.UsernameFrom.Resolve()
+		if err != nil {
+			return fmt.Errorf("Failed to get username: %v", err)
+		}
+
+		info.Username = username
+	}
+
+	if info.PasswordFrom != nil {
+		pwd, err := info.PasswordFrom.Resolve()
+		if err != nil {
+			return fmt.Errorf("Failed to get password: %v", err)
+		}
+
+		info.Password = pwd
 	}
 
 	return nil
 }
 
 func (sm *SourceManager) Uninit() error {
-	// Loading configuration file
-	config, err := sm.LoadSourceConfig(viper.GetString("source.config"))
+
+	close(sm.done)
+
+	// Waiting for acknowledgements takes a while, status of sources must be
+	// available meanwhile
+	sm.mu.RLock()
+	sources := make([]*Source, 0, len(sm.sources))
+	for _, source := range sm.sources {
+		sources = append(sources, source)
+	}
+	sm.mu.RUnlock()
+
+	for _, source := range sources {
+		source.Uninit()
+	}
+
+	return nil
+}
+
+func (sm *SourceManager) GetSource(name string) (*Source, error) {
+
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	source, ok := sm.sources[name]
+	if !ok {
+		return nil, ErrSourceNotFound
+	}
+
+	return source, nil
+}
+
+// ReloadSource restarts the source with its latest configuration
+func (sm *SourceManager) ReloadSource(name string) error {
+
+	sm.reloadMu.Lock()
+	defer sm.reloadMu.Unlock()
+
+	config, err := sm.validateConfig(func(n string, info SourceInfo) bool {
+		return n == name
+	})
 	if err != nil {
 		return err
 	}
 
-	// Initializing sources
-	for name, _ := range config.Sources {
-		if source, ok := sm.sources[name]; ok {
-			source.Uninit()
+	info, ok := config.Sources[name]
+	if !ok || info.Disabled {
+		return ErrSourceNotFound
+	}
+
+	previous := sm.stopSource(name)
+
+	return sm.applySource(name, info, previous)
+}
+
+// Reload applies changes of source configuration file. Only sources which
+// were added, removed or modified will be restarted.
+func (sm *SourceManager) Reload() error {
+
+	sm.reloadMu.Lock()
+	defer sm.reloadMu.Unlock()
+
+	sm.mu.RLock()
+	infos := make(map[string]SourceInfo, len(sm.infos))
+	for name, info := range sm.infos {
+		infos[name] = info
+	}
+	sm.mu.RUnlock()
+
+	// Unreachable database of a source which was not changed must not block
+	// others
+	config, err := sm.validateConfig(func(name string, info SourceInfo) bool {
+		current, ok := infos[name]
+		return !ok || !reflect.DeepEqual(current, info)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Stopping sources which were removed or modified
+	stopped := make(map[string]*Source)
+	for name, info := range infos {
+		newInfo, ok := config.Sources[name]
+		if ok && !newInfo.Disabled && reflect.DeepEqual(info, newInfo) {
+			continue
+		}
+
+		stopped[name] = sm.stopSource(name)
+	}
+
+	// Starting sources which were added or modified
+	var lastErr error
+	for name, info := range config.Sources {
+
+		if info.Disabled {
+			continue
+		}
+
+		if _, err := sm.GetSource(name); err == nil {
+			continue
 		}
+
+		err := sm.applySource(name, info, stopped[name])
+		if err != nil {
+			lastErr = err
+		}
+	}
+
+	return lastErr
+}
+
+// stopSource returns the source which was stopped, or nil if it was not
+// running
+func (sm *SourceManager) stopSource(name string) *Source {
+
+	sm.mu.Lock()
+	source, ok := sm.sources[name]
+	if ok {
+		delete(sm.sources, name)
+		delete(sm.infos, name)
 	}
+	sm.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	log.WithFields(log.Fields{
+		"name": name,
+	}).Info("Stopping source")
+
+	source.Uninit()
+
+	return source
+}
+
+// applySource starts source and resumes from the checkpoint in the store, or
+// from where previous source stopped if checkpoints are not persisted
+func (sm *SourceManager) applySource(name string, info SourceInfo, previous *Source) error {
+
+	source, err := sm.startSource(name, info, previous)
+	if err != nil {
+		return err
+	}
+
+	sm.mu.Lock()
+	sm.sources[name] = source
+	sm.infos[name] = info
+	sm.mu.Unlock()
+
+	log.WithFields(log.Fields{
+		"name": name,
+	}).Info("Source was reloaded")
+
 	return nil
 }
 
+// LoadSourceConfig reads JSON, YAML or TOML file by its extension
 func (sm *SourceManager) LoadSourceConfig(filename string) (*SourceConfig, error) {
 
 	// Open configuration file
-	jsonFile, err := os.Open(filename)
+	file, err := os.Open(filename)
 	if err != nil {
 		return nil, err
 	}
 
-	defer jsonFile.Close()
+	defer file.Close()
 
 	// Read
-	byteValue, _ := ioutil.ReadAll(jsonFile)
+	byteValue, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// Converting to JSON so all formats share the same schema
+	byteValue, err = convertToJSON(filename, byteValue)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+
+	var raw interface{}
+	err = json.Unmarshal(byteValue, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+
+	// Environment variables are expanded after parsing, so their values can
+	// not break syntax of file
+	raw, err = expandConfigEnv("", raw, reflect.TypeOf(SourceConfig{}))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+
+	byteValue, err = json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
 
 	var config SourceConfig
 
-	json.Unmarshal(byteValue, &config)
+	err = json.Unmarshal(byteValue, &config)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+
+	config.unknownKeys = unknownKeys("", raw, reflect.TypeOf(config))
 
 	return &config, nil
 }
@@ -0,0 +1,321 @@
+package adapter
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	OversizeTruncate   = "truncate"
+	OversizeDrop       = "drop"
+	OversizeClaimCheck = "claimCheck"
+)
+
+const (
+	DefaultOversizeMarker   = "__DROPPED__"
+	DefaultClaimCheckBucket = "gravity_claim_check"
+
+	// DefaultClaimCheckTTL is how long claim checks are kept in seconds
+	DefaultClaimCheckTTL = 7 * 24 * 60 * 60
+)
+
+var bucketNameRe = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// SourceOversize decides what to do with rows whose payload exceeds
+// maxMessageSize of source
+type SourceOversize struct {
+	Strategy string   `json:"strategy"`
+	Columns  []string `json:"columns"`
+	Marker   string   `json:"marker"`
+	Bucket   string   `json:"bucket"`
+	TTL      int      `json:"ttl"`
+	MaxBytes int64    `json:"maxBytes"`
+}
+
+func (o *SourceOversize) validate() []error {
+
+	errs := make([]error, 0)
+
+	switch o.Strategy {
+	case "", OversizeTruncate, OversizeDrop, OversizeClaimCheck:
+	default:
+		errs = append(errs, fmt.Errorf(".strategy: unknown strategy \"%s\", must be one of truncate, drop or claimCheck", o.Strategy))
+	}
+
+	if o.Bucket != "" && !bucketNameRe.MatchString(o.Bucket) {
+		errs = append(errs, fmt.Errorf(".bucket: invalid bucket name \"%s\"", o.Bucket))
+	}
+
+	if o.TTL < 0 {
+		errs = append(errs, fmt.Errorf(".ttl: invalid ttl %d", o.TTL))
+	}
+
+	if o.MaxBytes < 0 {
+		errs = append(errs, fmt.Errorf(".maxBytes: invalid size %d", o.MaxBytes))
+	}
+
+	return errs
+}
+
+func (o *SourceOversize) marker() string {
+	if o.Marker == "" {
+		return DefaultOversizeMarker
+	}
+
+	return o.Marker
+}
+
+func (o *SourceOversize) bucket() string {
+	if o.Bucket == "" {
+		return DefaultClaimCheckBucket
+	}
+
+	return o.Bucket
+}
+
+// bucketConfig is used to create bucket of claim checks, objects are removed
+// once they expire so the bucket does not grow forever
+func (o *SourceOversize) bucketConfig() *nats.ObjectStoreConfig {
+
+	ttl := o.TTL
+	if ttl == 0 {
+		ttl = DefaultClaimCheckTTL
+	}
+
+	return &nats.ObjectStoreConfig{
+		Bucket:   o.bucket(),
+		TTL:      time.Duration(ttl) * time.Second,
+		MaxBytes: o.MaxBytes,
+	}
+}
+
+// candidates returns columns which may be reduced in order, it is the
+// configured columns or all text columns from the largest one
+func (o *SourceOversize) candidates(data map[string]interface{}) []string {
+
+	if len(o.Columns) > 0 {
+		return o.Columns
+	}
+
+	columns := make([]string, 0)
+	for column, value := range data {
+		if _, ok := value.(string); ok {
+			columns = append(columns, column)
+		}
+	}
+
+	sort.Slice(columns, func(i, j int) bool {
+		return len(data[columns[i]].(string)) > len(data[columns[j]].(string))
+	})
+
+	return columns
+}
+
+// truncateString cuts s to at most n bytes without breaking a character
+func truncateString(s string, n int) string {
+
+	if n <= 0 {
+		return ""
+	}
+
+	if n >= len(s) {
+		return s
+	}
+
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+
+	return s[:n]
+}
+
+// messageSize returns size of message which is going to be published with
+// payload, including its headers
+func (source *Source) messageSize(request *Request, payload []byte) (int, error) {
+
+	meta := make(map[string]string, 2)
+	source.setMeta(request, meta)
+
+	return source.publisher.MessageSize(request.Req.EventName, payload, meta)
+}
+
+// messageLimit returns maximum size of message, which is maxMessageSize of
+// source but never more than max_payload of server. Messages are not checked
+// if neither maxMessageSize nor oversize strategy was set.
+func (source *Source) messageLimit() int {
+
+	limit := source.info.MaxMessageSize
+	if limit <= 0 && source.info.Oversize.Strategy == "" {
+		return 0
+	}
+
+	maxPayload := int(source.publisher.MaxPayload())
+	if maxPayload > 0 && (limit <= 0 || limit > maxPayload) {
+		return maxPayload
+	}
+
+	return limit
+}
+
+// shrinkPayload reduces columns of data until the message fits in limit.
+// Payload is returned unchanged if it fits already, or if there is no strategy
+// so it fails to be published and goes to dead letter.
+func (source *Source) shrinkPayload(request *Request, limit int, data map[string]interface{}, payload []byte) ([]byte, error) {
+
+	oversize := &source.info.Oversize
+
+	size, err := source.messageSize(request, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if size <= limit {
+		return payload, nil
+	}
+
+	if oversize.Strategy == "" {
+		log.WithFields(log.Fields{
+			"source": source.name,
+			"table":  request.Table,
+			"size":   size,
+		}).Warn("Message exceeds maximum message size")
+		return payload, nil
+	}
+
+	original := size
+	for _, column := range oversize.candidates(data) {
+
+		if size <= limit {
+			break
+		}
+
+		value, ok := data[column].(string)
+		if !ok {
+			continue
+		}
+
+		switch oversize.Strategy {
+		case OversizeTruncate:
+			// Escaping of JSON and base64 of envelope make message larger
+			// than the value, so it may take a few rounds
+			for size > limit && len(value) > 0 {
+				excess := (size - limit) * 3 / 4
+				if excess < 1 {
+					excess = 1
+				}
+
+				value = truncateString(value, len(value)-excess)
+				data[column] = value
+
+				payload, size, err = source.encodePayload(request, data)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			continue
+		case OversizeDrop:
+			data[column] = oversize.marker()
+		case OversizeClaimCheck:
+			ref, err := source.putClaimCheck(request.msgID(source.name)+"/"+column, value)
+			if err != nil {
+				return nil, err
+			}
+
+			data[column] = ref
+		}
+
+		payload, size, err = source.encodePayload(request, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	oversizeEventsCounter.WithLabelValues(source.name, request.Table, oversize.Strategy).Inc()
+
+	log.WithFields(log.Fields{
+		"source":   source.name,
+		"table":    request.Table,
+		"strategy": oversize.Strategy,
+		"size":     original,
+		"reduced":  size,
+	}).Warn("Message exceeds maximum message size, columns were reduced")
+
+	return payload, nil
+}
+
+func (source *Source) encodePayload(request *Request, data map[string]interface{}) ([]byte, int, error) {
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	size, err := source.messageSize(request, payload)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return payload, size, nil
+}
+
+// putClaimCheck stores value in object store, and returns the reference which
+// replaces the value in payload
+func (source *Source) putClaimCheck(name string, value string) (string, error) {
+
+	config := source.info.Oversize.bucketConfig()
+	bucket := config.Bucket
+
+	// Event must not be skipped, so keep trying until source was stopped
+	for {
+		err := source.putObject(config, name, value)
+		if err == nil {
+			return fmt.Sprintf("obj://%s/%s", bucket, name), nil
+		}
+
+		log.Error("Failed to store claim check: ", err, ", retry ...")
+
+		select {
+		case <-time.After(time.Second):
+		case <-source.done:
+			return "", err
+		}
+	}
+}
+
+func (source *Source) putObject(config *nats.ObjectStoreConfig, name string, value string) error {
+
+	source.mu.Lock()
+	if source.claimChecks == nil {
+		obs, err := source.publisher.ObjectStore(config)
+		if err != nil {
+			source.mu.Unlock()
+			return err
+		}
+
+		// Bucket which was created before keeps its own ttl
+		status, err := obs.Status()
+		if err == nil && status.TTL() != config.TTL {
+			log.WithFields(log.Fields{
+				"source": source.name,
+				"bucket": config.Bucket,
+				"ttl":    status.TTL(),
+			}).Warn("Claim check bucket has a different ttl")
+		}
+
+		source.claimChecks = obs
+	}
+	obs := source.claimChecks
+	source.mu.Unlock()
+
+	// Object is replaced if the same event is read again
+	_, err := obs.PutBytes(name, []byte(value))
+
+	return err
+}
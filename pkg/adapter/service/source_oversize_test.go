@@ -0,0 +1,41 @@
+package adapter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClaimCheckBucketConfig(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		oversize SourceOversize
+		bucket   string
+		ttl      time.Duration
+		maxBytes int64
+		valid    bool
+	}{
+		{"defaults", SourceOversize{}, DefaultClaimCheckBucket, 7 * 24 * time.Hour, 0, true},
+		{"configured", SourceOversize{Bucket: "claims", TTL: 3600, MaxBytes: 1 << 30}, "claims", time.Hour, 1 << 30, true},
+		{"negative ttl", SourceOversize{TTL: -1}, DefaultClaimCheckBucket, 0, 0, false},
+		{"negative max bytes", SourceOversize{MaxBytes: -1}, DefaultClaimCheckBucket, 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := tt.oversize.validate()
+			if (len(errs) == 0) != tt.valid {
+				t.Fatalf("errors %v, valid %v", errs, tt.valid)
+			}
+
+			if !tt.valid {
+				return
+			}
+
+			config := tt.oversize.bucketConfig()
+			if config.Bucket != tt.bucket || config.TTL != tt.ttl || config.MaxBytes != tt.maxBytes {
+				t.Fatalf("unexpected config %+v", config)
+			}
+		})
+	}
+}
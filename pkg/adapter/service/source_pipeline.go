@@ -0,0 +1,73 @@
+package adapter
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/spf13/viper"
+	"golang.org/x/time/rate"
+)
+
+const (
+	DefaultIncomingSize = 16
+)
+
+// SourcePipeline sizes pipeline of source, zero means default
+type SourcePipeline struct {
+	Incoming      int `json:"incoming"`
+	Partitions    int `json:"partitions"`
+	PartitionSize int `json:"partitionSize"`
+	MaxInflight   int `json:"maxInflight"`
+}
+
+func (p *SourcePipeline) validate() []error {
+
+	errs := make([]error, 0)
+
+	values := map[string]int{
+		"incoming":      p.Incoming,
+		"partitions":    p.Partitions,
+		"partitionSize": p.PartitionSize,
+		"maxInflight":   p.MaxInflight,
+	}
+
+	for _, field := range sortedKeys(values) {
+		if values[field] < 0 {
+			errs = append(errs, fmt.Errorf(".%s: must not be negative", field))
+		}
+	}
+
+	return errs
+}
+
+func orDefault(value int, def int) int {
+	if value <= 0 {
+		return def
+	}
+
+	return value
+}
+
+// newRateLimiter uses rate limit of source, or gravity.rateLimit if it was
+// not set. Burst is the number of events which can be sent at once.
+func (info *SourceInfo) newRateLimiter() *rate.Limiter {
+
+	viper.SetDefault("gravity.rateLimit", 0)
+	viper.SetDefault("gravity.rateBurst", 0)
+
+	rateLimit := viper.GetFloat64("gravity.rateLimit")
+	if info.RateLimit != nil {
+		rateLimit = *info.RateLimit
+	}
+
+	if rateLimit == 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+
+	burst := orDefault(info.RateBurst, viper.GetInt("gravity.rateBurst"))
+	if burst <= 0 {
+		burst = int(math.Ceil(rateLimit))
+	}
+
+	return rate.NewLimiter(rate.Limit(rateLimit), burst)
+}
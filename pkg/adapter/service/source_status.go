@@ -0,0 +1,73 @@
+package adapter
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+type SourceStatus struct {
+	Name               string             `json:"name"`
+	MySQLConnected     bool               `json:"mysqlConnected"`
+	MySQLError         string             `json:"mysqlError,omitempty"`
+	Reader             BinlogReaderStatus `json:"reader"`
+	SnapshotInProgress bool               `json:"snapshotInProgress"`
+	Inflight           int                `json:"inflight"`
+	Resending          bool               `json:"resending"`
+	LastEventTime      time.Time          `json:"lastEventTime,omitempty"`
+	Lag                ReplicationLag     `json:"lag"`
+}
+
+// Healthy reports whether the source is still able to capture changes
+func (status *SourceStatus) Healthy() bool {
+	return status.Reader.State != BinlogReaderFailed
+}
+
+// Ready reports whether the source is currently capturing changes or was
+// paused on purpose
+func (status *SourceStatus) Ready() bool {
+	if !status.MySQLConnected {
+		return false
+	}
+
+	return status.Reader.State == BinlogReaderRunning || status.Reader.State == BinlogReaderPaused
+}
+
+func (source *Source) GetStatus() SourceStatus {
+
+	status := SourceStatus{
+		Name:               source.name,
+		Reader:             source.database.GetReaderStatus(),
+		SnapshotInProgress: atomic.LoadInt32(&source.database.snapshotting) > 0,
+		Inflight:           source.window.Len(),
+		Resending:          source.window.isRecovering(),
+		Lag:                source.database.GetReplicationLag(),
+	}
+
+	_, status.LastEventTime = source.database.getProgress()
+
+	err := source.database.Ping()
+	if err != nil {
+		status.MySQLError = err.Error()
+	} else {
+		status.MySQLConnected = true
+	}
+
+	return status
+}
+
+func (sm *SourceManager) GetStatus() map[string]SourceStatus {
+
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	statuses := make(map[string]SourceStatus, len(sm.sources))
+	for name, source := range sm.sources {
+		statuses[name] = source.GetStatus()
+	}
+
+	return statuses
+}
+
+func (adapter *Adapter) GetSourceStatus() map[string]SourceStatus {
+	return adapter.sm.GetStatus()
+}
@@ -0,0 +1,114 @@
+package adapter
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	TLSModeDisabled  = "disabled"
+	TLSModePreferred = "preferred"
+	TLSModeRequired  = "required"
+)
+
+type SourceTLS struct {
+	Mode       string `json:"mode"`
+	CA         string `json:"ca"`
+	Cert       string `json:"cert"`
+	Key        string `json:"key"`
+	ServerName string `json:"serverName"`
+	SkipVerify bool   `json:"skipVerify"`
+}
+
+func (t *SourceTLS) Enabled() bool {
+	return t.Mode == TLSModePreferred || t.Mode == TLSModeRequired
+}
+
+func (t *SourceTLS) validate() []error {
+
+	errs := make([]error, 0)
+
+	switch t.Mode {
+	case "", TLSModeDisabled, TLSModePreferred, TLSModeRequired:
+	default:
+		errs = append(errs, fmt.Errorf(".mode: unknown mode \"%s\", must be one of disabled, preferred or required", t.Mode))
+	}
+
+	if (t.Cert == "") != (t.Key == "") {
+		errs = append(errs, errors.New(".cert: cert and key must be set together"))
+	}
+
+	for field, filename := range map[string]string{"ca": t.CA, "cert": t.Cert, "key": t.Key} {
+		if filename == "" {
+			continue
+		}
+
+		_, err := os.Stat(filename)
+		if err != nil {
+			errs = append(errs, fmt.Errorf(".%s: %v", field, err))
+		}
+	}
+
+	return errs
+}
+
+// newTLSConfig returns nil if TLS is disabled
+func (info *SourceInfo) newTLSConfig() (*tls.Config, error) {
+
+	t := &info.TLS
+	if !t.Enabled() {
+		return nil, nil
+	}
+
+	config := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.SkipVerify,
+	}
+
+	if config.ServerName == "" {
+		config.ServerName = info.Host
+	}
+
+	if t.CA != "" {
+		data, err := os.ReadFile(t.CA)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("No certificate was found in %s", t.CA)
+		}
+
+		config.RootCAs = pool
+	}
+
+	if t.Cert != "" {
+		cert, err := tls.LoadX509KeyPair(t.Cert, t.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// isTLSConnection reports whether connection of db is encrypted, it is used
+// to find out if server supports TLS in preferred mode
+func isTLSConnection(db *sqlx.DB) (bool, error) {
+
+	var name, cipher string
+	err := db.QueryRow("SHOW SESSION STATUS LIKE 'Ssl_cipher'").Scan(&name, &cipher)
+	if err != nil {
+		return false, err
+	}
+
+	return cipher != "", nil
+}
@@ -0,0 +1,299 @@
+package adapter
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	initMysql "github.com/go-sql-driver/mysql"
+	"github.com/spf13/viper"
+)
+
+// Validate reports every problem of source configuration at once
+func (config *SourceConfig) Validate() error {
+
+	errs := make([]error, 0)
+
+	for _, key := range config.unknownKeys {
+		errs = append(errs, fmt.Errorf("%s: unknown key", key))
+	}
+
+	if len(config.Sources) == 0 {
+		errs = append(errs, errors.New("sources: no source was defined"))
+	}
+
+	for _, name := range sortedKeys(config.Sources) {
+		info := config.Sources[name]
+		if info.Disabled {
+			continue
+		}
+
+		for _, err := range info.validate() {
+			errs = append(errs, fmt.Errorf("sources.%s%v", name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (info *SourceInfo) validate() []error {
+
+	errs := make([]error, 0)
+
+	if len(info.Host) == 0 {
+		errs = append(errs, errors.New(".host: required"))
+	}
+
+	if info.Port <= 0 || info.Port > 65535 {
+		errs = append(errs, fmt.Errorf(".port: invalid port %d, must be between 1 and 65535", info.Port))
+	}
+
+	if len(info.Username) == 0 && info.UsernameFrom == nil {
+		errs = append(errs, errors.New(".username: required"))
+	}
+
+	if info.UsernameFrom != nil {
+		for _, err := range info.UsernameFrom.validate() {
+			errs = append(errs, fmt.Errorf(".usernameFrom%v", err))
+		}
+	}
+
+	if info.PasswordFrom != nil {
+		for _, err := range info.PasswordFrom.validate() {
+			errs = append(errs, fmt.Errorf(".passwordFrom%v", err))
+		}
+	}
+
+	if len(info.DBName) == 0 {
+		errs = append(errs, errors.New(".dbname: required"))
+	}
+
+	switch info.BinlogPurgedPolicy {
+	case "", BinlogPurgedPolicyFail, BinlogPurgedPolicyEarliest, BinlogPurgedPolicyResnapshot:
+	default:
+		errs = append(errs, fmt.Errorf(".binlogPurgedPolicy: unknown policy \"%s\", must be one of fail, earliest or resnapshot", info.BinlogPurgedPolicy))
+	}
+
+	for _, err := range info.TLS.validate() {
+		errs = append(errs, fmt.Errorf(".tls%v", err))
+	}
+
+	if info.Heartbeat.Interval < 0 {
+		errs = append(errs, fmt.Errorf(".heartbeat.interval: invalid interval %d", info.Heartbeat.Interval))
+	}
+
+	if info.MaxMessageSize < 0 {
+		errs = append(errs, fmt.Errorf(".maxMessageSize: invalid size %d", info.MaxMessageSize))
+	}
+
+	for _, err := range info.Oversize.validate() {
+		errs = append(errs, fmt.Errorf(".oversize%v", err))
+	}
+
+	for _, err := range info.Pipeline.validate() {
+		errs = append(errs, fmt.Errorf(".pipeline%v", err))
+	}
+
+	if info.RateLimit != nil && *info.RateLimit < 0 {
+		errs = append(errs, errors.New(".rateLimit: must not be negative"))
+	}
+
+	if info.RateBurst < 0 {
+		errs = append(errs, errors.New(".rateBurst: must not be negative"))
+	}
+
+	if len(info.Tables) == 0 {
+		errs = append(errs, errors.New(".tables: no table was defined"))
+	}
+
+	for _, tableName := range sortedKeys(info.Tables) {
+		events := info.Tables[tableName].Events
+		if events == (SourceTableEvents{}) {
+			errs = append(errs, fmt.Errorf(".tables.%s.events: no event was defined", tableName))
+		}
+	}
+
+	// Publishing checkpoints would write another checkpoint endlessly
+	if checkpointStoreType() == CheckpointStoreMySQL {
+		viper.SetDefault("checkpoint.table", DefaultCheckpointTable)
+		table := viper.GetString("checkpoint.table")
+		if _, ok := info.Tables[table]; ok {
+			errs = append(errs, fmt.Errorf(".tables.%s: checkpoint table must not be watched", table))
+		}
+	}
+
+	return errs
+}
+
+// checkTables makes sure all tables exist in the database
+func (info *SourceInfo) checkTables() []error {
+
+	config, err := newMySQLConfig(info)
+	if err != nil {
+		return []error{fmt.Errorf(".tls: %v", err)}
+	}
+
+	connector, err := initMysql.NewConnector(config)
+	if err != nil {
+		return []error{fmt.Errorf(": %v", err)}
+	}
+
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	rows, err := db.Query("SELECT TABLE_NAME FROM information_schema.TABLES WHERE TABLE_SCHEMA = ?", info.DBName)
+	if err != nil {
+		return []error{fmt.Errorf(": failed to get tables: %v", err)}
+	}
+	defer rows.Close()
+
+	tables := make(map[string]bool)
+	for rows.Next() {
+		var tableName string
+		err := rows.Scan(&tableName)
+		if err != nil {
+			return []error{fmt.Errorf(": failed to get tables: %v", err)}
+		}
+
+		tables[tableName] = true
+	}
+
+	errs := make([]error, 0)
+	for _, tableName := range sortedKeys(info.Tables) {
+		if !tables[tableName] {
+			errs = append(errs, fmt.Errorf(".tables.%s: table does not exist in database \"%s\"", tableName, info.DBName))
+		}
+	}
+
+	return errs
+}
+
+// ValidateConfig loads source configuration and checks it against databases
+func (sm *SourceManager) ValidateConfig() (*SourceConfig, error) {
+	return sm.validateConfig(func(string, SourceInfo) bool {
+		return true
+	})
+}
+
+// validateConfig only checks connections of sources which are accepted by
+// filter
+func (sm *SourceManager) validateConfig(filter func(name string, info SourceInfo) bool) (*SourceConfig, error) {
+
+	config, err := sm.LoadSourceConfig(viper.GetString("source.config"))
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	errs := make([]error, 0)
+	for _, name := range sortedKeys(config.Sources) {
+		info := config.Sources[name]
+		if info.Disabled || !filter(name, info) {
+			continue
+		}
+
+		err := resolveCredentials(name, &info)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("sources.%s: %v", name, err))
+			continue
+		}
+
+		for _, err := range info.checkTables() {
+			errs = append(errs, fmt.Errorf("sources.%s%v", name, err))
+		}
+	}
+
+	err = errors.Join(errs...)
+	if err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+func (adapter *Adapter) ValidateConfig() error {
+	_, err := adapter.sm.ValidateConfig()
+	return err
+}
+
+// unknownKeys returns keys of raw which are not defined by json tags of t
+func unknownKeys(prefix string, raw interface{}, t reflect.Type) []string {
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	keys := make([]string, 0)
+
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := raw.(map[string]interface{})
+		if !ok {
+			return keys
+		}
+
+		fields := jsonFields(t)
+
+		for _, key := range sortedKeys(obj) {
+			fieldType, ok := fields[key]
+			if !ok {
+				keys = append(keys, prefix+key)
+				continue
+			}
+
+			keys = append(keys, unknownKeys(prefix+key+".", obj[key], fieldType)...)
+		}
+
+	case reflect.Map:
+		obj, ok := raw.(map[string]interface{})
+		if !ok {
+			return keys
+		}
+
+		for _, key := range sortedKeys(obj) {
+			keys = append(keys, unknownKeys(prefix+key+".", obj[key], t.Elem())...)
+		}
+	}
+
+	return keys
+}
+
+// jsonFields returns types of exported fields of struct t by their json names
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+
+	fields := make(map[string]reflect.Type, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = field.Name
+		}
+
+		fields[name] = field.Type
+	}
+
+	return fields
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,88 @@
+package adapter
+
+import (
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const DefaultWatchDelay = 1
+
+// watchConfig reloads sources when configuration file was changed or SIGHUP
+// was received.
+func (sm *SourceManager) watchConfig() {
+
+	viper.SetDefault("source.watchConfig", true)
+	viper.SetDefault("source.watchDelay", DefaultWatchDelay)
+	delay := time.Duration(viper.GetInt64("source.watchDelay")) * time.Second
+
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	defer signal.Stop(sighup)
+
+	filename, err := filepath.Abs(viper.GetString("source.config"))
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	var events chan fsnotify.Event
+	if viper.GetBool("source.watchConfig") {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			log.Error("Failed to watch source configuration file: ", err)
+		} else {
+			defer watcher.Close()
+
+			// Watching directory instead of file because ConfigMap of Kubernetes
+			// replaces files by switching symlink of the directory
+			err = watcher.Add(filepath.Dir(filename))
+			if err != nil {
+				log.Error("Failed to watch source configuration file: ", err)
+			}
+
+			events = watcher.Events
+		}
+	}
+
+	// Waiting for a while because editors usually write file more than once
+	timer := time.NewTimer(delay)
+	timer.Stop()
+
+	for {
+		select {
+		case <-sm.done:
+			return
+		case <-sighup:
+			log.Info("Received SIGHUP, reloading sources")
+			sm.reload()
+		case event := <-events:
+			if filepath.Clean(event.Name) != filename && filepath.Base(event.Name) != "..data" {
+				continue
+			}
+
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) == 0 {
+				continue
+			}
+
+			timer.Reset(delay)
+		case <-timer.C:
+			log.Info("Source configuration file was changed, reloading sources")
+			sm.reload()
+		}
+	}
+}
+
+func (sm *SourceManager) reload() {
+
+	err := sm.Reload()
+	if err != nil {
+		log.Error("Failed to reload sources: ", err)
+	}
+}
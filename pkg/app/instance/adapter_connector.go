@@ -1,11 +1,15 @@
 package instance
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"os"
+	"strings"
 	"time"
 
-	gravity_adapter "github.com/BrobridgeOrg/gravity-sdk/v2/adapter"
-	"github.com/BrobridgeOrg/gravity-sdk/v2/core"
+	"git.brobridge.com/gravity/gravity-adapter-mysql/pkg/connector"
+	"github.com/nats-io/nats.go"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
@@ -24,54 +28,189 @@ func (a *AppInstance) initAdapterConnector() error {
 	viper.SetDefault("gravity.pingInterval", DefaultPingInterval)
 	viper.SetDefault("gravity.maxPingsOutstanding", DefaultMaxPingsOutstanding)
 	viper.SetDefault("gravity.maxReconnects", DefaultMaxReconnects)
+	viper.SetDefault("gravity.retryOnFailedConnect", false)
 	viper.SetDefault("gravity.accessToken", "")
+	viper.SetDefault("gravity.compression", string(connector.S2Compression))
+	viper.SetDefault("gravity.compressionThreshold", 0)
 
 	// Read configs
 	domain := viper.GetString("gravity.domain")
-	host := viper.GetString("gravity.host")
-	port := viper.GetInt("gravity.port")
 	pingInterval := viper.GetInt64("gravity.pingInterval")
 	maxPingsOutstanding := viper.GetInt("gravity.maxPingsOutstanding")
 	maxReconnects := viper.GetInt("gravity.maxReconnects")
-	accessToken := viper.GetString("gravity.accessToken")
+	compression, err := connector.ParseCompression(viper.GetString("gravity.compression"))
+	if err != nil {
+		return err
+	}
+
+	// Startup fails on wrong servers or credentials unless it was enabled
+	retryOnFailedConnect := viper.GetBool("gravity.retryOnFailedConnect")
 
 	// Preparing options
-	options := core.NewOptions()
-	options.PingInterval = time.Duration(pingInterval) * time.Second
-	options.MaxPingsOutstanding = maxPingsOutstanding
-	options.MaxReconnects = maxReconnects
-	options.Token = accessToken
+	options := []nats.Option{
+		nats.RetryOnFailedConnect(retryOnFailedConnect),
+		nats.PingInterval(time.Duration(pingInterval) * time.Second),
+		nats.MaxPingsOutstanding(maxPingsOutstanding),
+		nats.MaxReconnects(maxReconnects),
+		nats.ConnectHandler(func(nc *nats.Conn) {
+			log.WithFields(log.Fields{
+				"server": nc.ConnectedUrlRedacted(),
+			}).Info("Connected to gravity")
+		}),
+		nats.DisconnectErrHandler(func(nc *nats.Conn, err error) {
+			log.Warn("Disconnected from gravity: ", err)
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			log.WithFields(log.Fields{
+				"server": nc.ConnectedUrlRedacted(),
+			}).Info("Reconnected to gravity")
+		}),
+		nats.DiscoveredServersHandler(func(nc *nats.Conn) {
+			log.WithFields(log.Fields{
+				"servers": nc.DiscoveredServers(),
+			}).Info("Discovered servers of gravity cluster")
+		}),
+	}
 
-	address := fmt.Sprintf("%s:%d", host, port)
+	authOptions, err := natsAuthOptions()
+	if err != nil {
+		return err
+	}
+
+	options = append(options, authOptions...)
+
+	servers := gravityServers()
+	address := strings.Join(servers, ",")
 
 	log.WithFields(log.Fields{
-		"address":             address,
-		"pingInterval":        options.PingInterval,
-		"maxPingsOutstanding": options.MaxPingsOutstanding,
-		"maxReconnects":       options.MaxReconnects,
+		"servers":              servers,
+		"pingInterval":         pingInterval,
+		"maxPingsOutstanding":  maxPingsOutstanding,
+		"maxReconnects":        maxReconnects,
+		"retryOnFailedConnect": retryOnFailedConnect,
+		"compression":          compression,
 	}).Info("Connecting to gravity...")
 
-	// Connect to gravity
-	client := core.NewClient()
-	err := client.Connect(address, options)
+	// Connect to gravity, connection fails over between servers on reconnect
+	nc, err := nats.Connect(address, options...)
 	if err != nil {
 		return err
 	}
 
-	// Initializing gravity adapter connector
-	opts := gravity_adapter.NewOptions()
-	opts.Domain = domain
-	opts.Compression = gravity_adapter.S2Compression
+	a.nc = nc
 
-	a.adapterConnector = gravity_adapter.NewAdapterConnectorWithClient(client, opts)
-	err = a.adapterConnector.Connect(address, options)
-	if err != nil {
-		return err
-	}
+	// Options of publishers which sources publish events with
+	a.publisherOptions = connector.NewOptions()
+	a.publisherOptions.Domain = domain
+	a.publisherOptions.Compression = compression
+	a.publisherOptions.CompressionThreshold = viper.GetInt("gravity.compressionThreshold")
 
 	return nil
 }
 
-func (a *AppInstance) GetAdapterConnector() *gravity_adapter.AdapterConnector {
-	return a.adapterConnector
+// gravityServers returns seed list of gravity cluster, it falls back to
+// gravity.host and gravity.port if gravity.servers was not set
+func gravityServers() []string {
+
+	servers := make([]string, 0)
+	for _, value := range viper.GetStringSlice("gravity.servers") {
+		for _, server := range strings.Split(value, ",") {
+			server = strings.TrimSpace(server)
+			if server != "" {
+				servers = append(servers, server)
+			}
+		}
+	}
+
+	if len(servers) > 0 {
+		return servers
+	}
+
+	return []string{
+		fmt.Sprintf("%s:%d", viper.GetString("gravity.host"), viper.GetInt("gravity.port")),
+	}
+}
+
+// natsAuthOptions prepares authentication and TLS options of NATS
+func natsAuthOptions() ([]nats.Option, error) {
+
+	options := make([]nats.Option, 0)
+
+	if token := viper.GetString("gravity.accessToken"); token != "" {
+		options = append(options, nats.Token(token))
+	}
+
+	if username := viper.GetString("gravity.username"); username != "" {
+		options = append(options, nats.UserInfo(username, viper.GetString("gravity.password")))
+	}
+
+	if credsFile := viper.GetString("gravity.credsFile"); credsFile != "" {
+		options = append(options, nats.UserCredentials(credsFile))
+	}
+
+	if nkeyFile := viper.GetString("gravity.nkeyFile"); nkeyFile != "" {
+		opt, err := nats.NkeyOptionFromSeed(nkeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		options = append(options, opt)
+	}
+
+	if viper.GetBool("gravity.tls.enabled") {
+		tlsConfig, err := natsTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+
+		options = append(options, nats.Secure(tlsConfig))
+	}
+
+	return options, nil
+}
+
+func natsTLSConfig() (*tls.Config, error) {
+
+	config := &tls.Config{
+		ServerName:         viper.GetString("gravity.tls.serverName"),
+		InsecureSkipVerify: viper.GetBool("gravity.tls.skipVerify"),
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if ca := viper.GetString("gravity.tls.ca"); ca != "" {
+		data, err := os.ReadFile(ca)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("No certificate was found in %s", ca)
+		}
+
+		config.RootCAs = pool
+	}
+
+	cert := viper.GetString("gravity.tls.cert")
+	key := viper.GetString("gravity.tls.key")
+	if cert != "" || key != "" {
+		certificate, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, err
+		}
+
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	return config, nil
+}
+
+// GetConnection returns connection to gravity which is shared by sources
+func (a *AppInstance) GetConnection() *nats.Conn {
+	return a.nc
+}
+
+// NewPublisher creates a publisher on connection to gravity for source
+func (a *AppInstance) NewPublisher() (*connector.Publisher, error) {
+	return connector.NewPublisher(a.nc, a.publisherOptions)
 }
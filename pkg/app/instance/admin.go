@@ -0,0 +1,201 @@
+package instance
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	adapter_service "git.brobridge.com/gravity/gravity-adapter-mysql/pkg/adapter/service"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+type ResetCheckpointRequest struct {
+	PosName string `json:"posName"`
+	Pos     uint32 `json:"pos"`
+}
+
+type AdminResponse struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+func (a *AppInstance) registerAdminHandlers(mux *http.ServeMux) {
+
+	viper.SetDefault("admin.enabled", false)
+	if !viper.GetBool("admin.enabled") {
+		return
+	}
+
+	log.Info("Enabled admin API")
+
+	handlers := map[string]http.HandlerFunc{
+		"GET /api/sources":                                 a.listSourcesHandler,
+		"GET /api/sources/{name}":                          a.getSourceHandler,
+		"POST /api/sources/{name}/pause":                   a.pauseSourceHandler,
+		"POST /api/sources/{name}/resume":                  a.resumeSourceHandler,
+		"POST /api/sources/{name}/reload":                  a.reloadSourceHandler,
+		"POST /api/sources/{name}/tables/{table}/snapshot": a.snapshotTableHandler,
+		"GET /api/sources/{name}/checkpoint":               a.getCheckpointHandler,
+		"PUT /api/sources/{name}/checkpoint":               a.resetCheckpointHandler,
+		"DELETE /api/sources/{name}/checkpoint":            a.resetCheckpointHandler,
+	}
+
+	for pattern, handler := range handlers {
+		mux.Handle(pattern, a.adminAuth(handler))
+	}
+}
+
+// adminAuth requires bearer token of admin.token, every request is rejected
+// if the token was not set
+func (a *AppInstance) adminAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		token := viper.GetString("admin.token")
+		expected := []byte("Bearer " + token)
+		if token == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			writeJSON(w, http.StatusUnauthorized, &AdminResponse{Error: "unauthorized"})
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func (a *AppInstance) listSourcesHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.adapter.GetSourceStatus())
+}
+
+func (a *AppInstance) getSourceHandler(w http.ResponseWriter, r *http.Request) {
+
+	source, ok := a.getSource(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, source.GetStatus())
+}
+
+func (a *AppInstance) pauseSourceHandler(w http.ResponseWriter, r *http.Request) {
+
+	source, ok := a.getSource(w, r)
+	if !ok {
+		return
+	}
+
+	source.Pause()
+
+	writeJSON(w, http.StatusOK, &AdminResponse{Success: true})
+}
+
+func (a *AppInstance) resumeSourceHandler(w http.ResponseWriter, r *http.Request) {
+
+	source, ok := a.getSource(w, r)
+	if !ok {
+		return
+	}
+
+	source.Resume()
+
+	writeJSON(w, http.StatusOK, &AdminResponse{Success: true})
+}
+
+func (a *AppInstance) reloadSourceHandler(w http.ResponseWriter, r *http.Request) {
+
+	err := a.adapter.ReloadSource(r.PathValue("name"))
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &AdminResponse{Success: true})
+}
+
+func (a *AppInstance) snapshotTableHandler(w http.ResponseWriter, r *http.Request) {
+
+	source, ok := a.getSource(w, r)
+	if !ok {
+		return
+	}
+
+	err := source.ResnapshotTable(r.PathValue("table"))
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, &AdminResponse{Success: true})
+}
+
+func (a *AppInstance) getCheckpointHandler(w http.ResponseWriter, r *http.Request) {
+
+	source, ok := a.getSource(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, source.GetCheckpoint())
+}
+
+// resetCheckpointHandler moves checkpoint to the specific position, or to the
+// current position of master if no position was given.
+func (a *AppInstance) resetCheckpointHandler(w http.ResponseWriter, r *http.Request) {
+
+	source, ok := a.getSource(w, r)
+	if !ok {
+		return
+	}
+
+	var req ResetCheckpointRequest
+	if r.Method == http.MethodPut && r.ContentLength != 0 {
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, &AdminResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	err := source.ResetCheckpoint(req.PosName, req.Pos)
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, source.GetCheckpoint())
+}
+
+func (a *AppInstance) getSource(w http.ResponseWriter, r *http.Request) (*adapter_service.Source, bool) {
+
+	source, err := a.adapter.GetSource(r.PathValue("name"))
+	if err != nil {
+		writeAdminError(w, err)
+		return nil, false
+	}
+
+	return source, true
+}
+
+func writeAdminError(w http.ResponseWriter, err error) {
+
+	code := http.StatusInternalServerError
+	switch err {
+	case adapter_service.ErrSourceNotFound, adapter_service.ErrTableNotFound:
+		code = http.StatusNotFound
+	case adapter_service.ErrSourceNotPaused, adapter_service.ErrSnapshotInProgress, adapter_service.ErrReaderNotStopped:
+		code = http.StatusConflict
+	}
+
+	writeJSON(w, code, &AdminResponse{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(data)
+}
@@ -1,21 +1,29 @@
 package instance
 
 import (
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"runtime"
+	"strings"
+	"sync/atomic"
 	"syscall"
 
 	adapter_service "git.brobridge.com/gravity/gravity-adapter-mysql/pkg/adapter/service"
-	gravity_adapter "github.com/BrobridgeOrg/gravity-sdk/v2/adapter"
+	"git.brobridge.com/gravity/gravity-adapter-mysql/pkg/connector"
+	"github.com/nats-io/nats.go"
 	log "github.com/sirupsen/logrus"
 )
 
 type AppInstance struct {
 	done             chan os.Signal
 	adapter          *adapter_service.Adapter
-	adapterConnector *gravity_adapter.AdapterConnector
+	nc               *nats.Conn
+	publisherOptions *connector.Options
+	httpServer       *http.Server
+	initialized      int32
 }
 
 func NewAppInstance() *AppInstance {
@@ -38,8 +46,24 @@ func (a *AppInstance) Init() error {
 		"max_procs": runtime.GOMAXPROCS(0),
 	}).Info("Starting application")
 
+	// Checking configurations before connecting to anything
+	err := errors.Join(validateConfig(), a.adapter.ValidateConfig())
+	if err != nil {
+		for _, line := range strings.Split(err.Error(), "\n") {
+			log.Error("Invalid configuration: ", line)
+		}
+
+		return errors.New("invalid configuration")
+	}
+
+	// Initializing HTTP server for metrics and health checks
+	err = a.initHTTPServer()
+	if err != nil {
+		return err
+	}
+
 	// Initializing adapter connector
-	err := a.initAdapterConnector()
+	err = a.initAdapterConnector()
 	if err != nil {
 		return err
 	}
@@ -49,11 +73,21 @@ func (a *AppInstance) Init() error {
 		return err
 	}
 
+	atomic.StoreInt32(&a.initialized, 1)
+
 	return nil
 }
 
 func (a *AppInstance) Uninit() {
 	a.adapter.Uninit()
+
+	if a.nc != nil {
+		a.nc.Close()
+	}
+
+	if a.httpServer != nil {
+		a.httpServer.Close()
+	}
 }
 
 func (a *AppInstance) Run() error {
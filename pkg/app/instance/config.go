@@ -0,0 +1,226 @@
+package instance
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	adapter_service "git.brobridge.com/gravity/gravity-adapter-mysql/pkg/adapter/service"
+	"git.brobridge.com/gravity/gravity-adapter-mysql/pkg/connector"
+	"github.com/spf13/viper"
+)
+
+// All keys which are supported by config.toml
+var configKeys = []string{
+	"gravity.domain",
+	"gravity.servers",
+	"gravity.host",
+	"gravity.port",
+	"gravity.pingInterval",
+	"gravity.maxPingsOutstanding",
+	"gravity.maxReconnects",
+	"gravity.retryOnFailedConnect",
+	"gravity.accessToken",
+	"gravity.username",
+	"gravity.password",
+	"gravity.credsFile",
+	"gravity.nkeyFile",
+	"gravity.tls.enabled",
+	"gravity.tls.ca",
+	"gravity.tls.cert",
+	"gravity.tls.key",
+	"gravity.tls.serverName",
+	"gravity.tls.skipVerify",
+	"gravity.publishBatchSize",
+	"gravity.maxInflight",
+	"gravity.ackTimeout",
+	"gravity.rateLimit",
+	"gravity.rateBurst",
+	"gravity.compression",
+	"gravity.compressionThreshold",
+	"gravity.consumerEncodings",
+	"deadLetter.type",
+	"deadLetter.subject",
+	"deadLetter.path",
+	"deadLetter.maxRetries",
+	"source.config",
+	"source.reconnectInterval",
+	"source.reconnectMaxInterval",
+	"source.reconnectMaxRetries",
+	"source.lagInterval",
+	"source.watchConfig",
+	"source.watchDelay",
+	"checkpoint.type",
+	"checkpoint.bucket",
+	"checkpoint.table",
+	"checkpoint.path",
+	"checkpoint.flushInterval",
+	"store.enabled",
+	"store.path",
+	"http.enabled",
+	"http.host",
+	"http.port",
+	"admin.enabled",
+	"admin.token",
+	"vault.address",
+	"vault.token",
+	"vault.tokenFile",
+	"vault.namespace",
+	"vault.timeout",
+	"crypto.keys",
+	"crypto.keyFile",
+	"crypto.activeKey",
+}
+
+// validateServer accepts bare host:port as well as URL with scheme, such as
+// nats://host:port or tls://host:port
+func validateServer(server string) error {
+
+	host := server
+	if strings.Contains(server, "://") {
+		u, err := url.Parse(server)
+		if err != nil {
+			return err
+		}
+
+		if u.Host == "" {
+			return fmt.Errorf("missing host in \"%s\"", server)
+		}
+
+		// Port is optional in URL
+		if u.Port() == "" {
+			return nil
+		}
+
+		host = u.Host
+	}
+
+	hostname, port, err := net.SplitHostPort(host)
+	if err != nil {
+		return err
+	}
+
+	if hostname == "" {
+		return fmt.Errorf("missing host in \"%s\"", server)
+	}
+
+	n, err := strconv.Atoi(port)
+	if err != nil || n <= 0 || n > 65535 {
+		return fmt.Errorf("invalid port in \"%s\"", server)
+	}
+
+	return nil
+}
+
+// validateConfig reports every problem of config.toml at once
+func validateConfig() error {
+
+	errs := make([]error, 0)
+
+	known := make(map[string]bool, len(configKeys))
+	for _, key := range configKeys {
+		known[strings.ToLower(key)] = true
+	}
+
+	keys := viper.AllKeys()
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !known[key] {
+			errs = append(errs, fmt.Errorf("%s: unknown key", key))
+		}
+	}
+
+	if len(viper.GetStringSlice("gravity.servers")) == 0 && len(viper.GetString("gravity.host")) == 0 {
+		errs = append(errs, errors.New("gravity.host: required if gravity.servers was not set"))
+	}
+
+	for _, server := range gravityServers() {
+		err := validateServer(server)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("gravity.servers: %v", err))
+		}
+	}
+
+	for _, key := range []string{"gravity.port", "http.port"} {
+		if !viper.IsSet(key) {
+			continue
+		}
+
+		port := viper.GetInt(key)
+		if port <= 0 || port > 65535 {
+			errs = append(errs, fmt.Errorf("%s: invalid port %d, must be between 1 and 65535", key, port))
+		}
+	}
+
+	for _, key := range []string{"gravity.credsFile", "gravity.nkeyFile", "gravity.tls.ca", "gravity.tls.cert", "gravity.tls.key"} {
+		filename := viper.GetString(key)
+		if filename == "" {
+			continue
+		}
+
+		_, err := os.Stat(filename)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", key, err))
+		}
+	}
+
+	if (viper.GetString("gravity.tls.cert") == "") != (viper.GetString("gravity.tls.key") == "") {
+		errs = append(errs, errors.New("gravity.tls.cert: cert and key must be set together"))
+	}
+
+	if viper.GetBool("admin.enabled") && viper.GetString("admin.token") == "" {
+		errs = append(errs, errors.New("admin.token: required if admin API was enabled"))
+	}
+
+	if len(viper.GetString("source.config")) == 0 {
+		errs = append(errs, errors.New("source.config: required"))
+	}
+
+	for _, key := range []string{"gravity.publishBatchSize", "gravity.maxInflight", "gravity.ackTimeout"} {
+		if viper.IsSet(key) && viper.GetInt64(key) <= 0 {
+			errs = append(errs, fmt.Errorf("%s: must be greater than 0", key))
+		}
+	}
+
+	for _, key := range []string{"gravity.rateLimit", "gravity.rateBurst"} {
+		if viper.IsSet(key) && viper.GetFloat64(key) < 0 {
+			errs = append(errs, fmt.Errorf("%s: must not be negative", key))
+		}
+	}
+
+	viper.SetDefault("gravity.consumerEncodings", connector.DefaultConsumerEncodings)
+	compression, err := connector.ParseCompression(viper.GetString("gravity.compression"))
+	if err != nil {
+		errs = append(errs, fmt.Errorf("gravity.compression: %v", err))
+	} else if encodings := viper.GetStringSlice("gravity.consumerEncodings"); !compression.DecodedBy(encodings) {
+		errs = append(errs, fmt.Errorf("gravity.compression: consumers can not decode \"%s\", it must be listed in gravity.consumerEncodings %v after all consumers were upgraded", compression, encodings))
+	}
+
+	if viper.GetInt("gravity.compressionThreshold") < 0 {
+		errs = append(errs, errors.New("gravity.compressionThreshold: must not be negative"))
+	}
+
+	switch viper.GetString("checkpoint.type") {
+	case "", adapter_service.CheckpointStoreNone, adapter_service.CheckpointStoreBroton, adapter_service.CheckpointStoreJetStream,
+		adapter_service.CheckpointStoreMySQL, adapter_service.CheckpointStoreFile:
+	default:
+		errs = append(errs, fmt.Errorf("checkpoint.type: unknown type \"%s\", must be one of none, broton, jetstream, mysql or file", viper.GetString("checkpoint.type")))
+	}
+
+	switch viper.GetString("deadLetter.type") {
+	case "", adapter_service.DeadLetterNone, adapter_service.DeadLetterSubject, adapter_service.DeadLetterFile:
+	default:
+		errs = append(errs, fmt.Errorf("deadLetter.type: unknown type \"%s\", must be one of none, subject or file", viper.GetString("deadLetter.type")))
+	}
+
+	if viper.IsSet("deadLetter.maxRetries") && viper.GetInt("deadLetter.maxRetries") < 0 {
+		errs = append(errs, errors.New("deadLetter.maxRetries: must not be negative"))
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,78 @@
+package instance
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	adapter_service "git.brobridge.com/gravity/gravity-adapter-mysql/pkg/adapter/service"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/nats-io/nats.go"
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+type HealthStatus struct {
+	Status  string                                  `json:"status"`
+	NATS    string                                  `json:"nats"`
+	Server  string                                  `json:"server,omitempty"`
+	Servers []string                                `json:"servers,omitempty"`
+	Sources map[string]adapter_service.SourceStatus `json:"sources"`
+}
+
+func (a *AppInstance) getHealthStatus() *HealthStatus {
+
+	status := &HealthStatus{
+		Status:  "ok",
+		NATS:    nats.DISCONNECTED.String(),
+		Sources: a.adapter.GetSourceStatus(),
+	}
+
+	if nc := a.nc; nc != nil {
+		status.NATS = nc.Status().String()
+		status.Server = nc.ConnectedUrlRedacted()
+		status.Servers = nc.Servers()
+	}
+
+	return status
+}
+
+// healthzHandler fails when the adapter can not recover by itself
+func (a *AppInstance) healthzHandler(w http.ResponseWriter, r *http.Request) {
+
+	status := a.getHealthStatus()
+
+	healthy := status.NATS != nats.CLOSED.String()
+	for _, source := range status.Sources {
+		if !source.Healthy() {
+			healthy = false
+		}
+	}
+
+	a.writeHealthStatus(w, status, healthy)
+}
+
+// readyzHandler fails until every source is capturing changes
+func (a *AppInstance) readyzHandler(w http.ResponseWriter, r *http.Request) {
+
+	status := a.getHealthStatus()
+
+	ready := atomic.LoadInt32(&a.initialized) == 1 && status.NATS == nats.CONNECTED.String()
+	for _, source := range status.Sources {
+		if !source.Ready() {
+			ready = false
+		}
+	}
+
+	a.writeHealthStatus(w, status, ready)
+}
+
+func (a *AppInstance) writeHealthStatus(w http.ResponseWriter, status *HealthStatus, ok bool) {
+
+	code := http.StatusOK
+	if !ok {
+		status.Status = "unavailable"
+		code = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, code, status)
+}
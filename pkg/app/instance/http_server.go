@@ -0,0 +1,53 @@
+package instance
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const (
+	DefaultHTTPHost = "0.0.0.0"
+	DefaultHTTPPort = 8080
+)
+
+func (a *AppInstance) initHTTPServer() error {
+
+	// default settings
+	viper.SetDefault("http.enabled", true)
+	viper.SetDefault("http.host", DefaultHTTPHost)
+	viper.SetDefault("http.port", DefaultHTTPPort)
+
+	if !viper.GetBool("http.enabled") {
+		return nil
+	}
+
+	address := fmt.Sprintf("%s:%d", viper.GetString("http.host"), viper.GetInt("http.port"))
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", a.healthzHandler)
+	mux.HandleFunc("/readyz", a.readyzHandler)
+	a.registerAdminHandlers(mux)
+
+	a.httpServer = &http.Server{
+		Addr:    address,
+		Handler: mux,
+	}
+
+	log.WithFields(log.Fields{
+		"address": address,
+	}).Info("Starting HTTP server")
+
+	go func() {
+		err := a.httpServer.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			log.Error("HTTP server stopped: ", err)
+		}
+	}()
+
+	return nil
+}
@@ -1,9 +1,11 @@
 package app
 
 import (
-	gravity_adapter "github.com/BrobridgeOrg/gravity-sdk/v2/adapter"
+	"git.brobridge.com/gravity/gravity-adapter-mysql/pkg/connector"
+	"github.com/nats-io/nats.go"
 )
 
 type App interface {
-	GetAdapterConnector() *gravity_adapter.AdapterConnector
+	GetConnection() *nats.Conn
+	NewPublisher() (*connector.Publisher, error)
 }
@@ -0,0 +1,125 @@
+package connector
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Compression is also the value of Content-Encoding header of messages.
+// Consumers must decode it, gravity only decodes s2 by default.
+type Compression string
+
+const (
+	NoCompression   Compression = "none"
+	S2Compression   Compression = "s2"
+	GzipCompression Compression = "gzip"
+	ZstdCompression Compression = "zstd"
+)
+
+// DefaultConsumerEncodings are encodings which all consumers of gravity decode
+var DefaultConsumerEncodings = []string{string(S2Compression)}
+
+func ParseCompression(name string) (Compression, error) {
+
+	switch c := Compression(name); c {
+	case "":
+		return NoCompression, nil
+	case NoCompression, S2Compression, GzipCompression, ZstdCompression:
+		return c, nil
+	}
+
+	return NoCompression, fmt.Errorf("unknown compression \"%s\", must be one of none, s2, gzip or zstd", name)
+}
+
+// DecodedBy reports whether consumers which decode encodings can read
+// messages compressed with c
+func (c Compression) DecodedBy(encodings []string) bool {
+
+	if c == NoCompression {
+		return true
+	}
+
+	for _, encoding := range encodings {
+		if Compression(encoding) == c {
+			return true
+		}
+	}
+
+	return false
+}
+
+var (
+	compressionRatio = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "gravity_adapter_mysql",
+		Name:      "compression_ratio",
+		Help:      "Size of compressed message divided by its original size",
+		Buckets:   prometheus.LinearBuckets(0.1, 0.1, 10),
+	}, []string{"compression"})
+
+	compressedBytesCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gravity_adapter_mysql",
+		Name:      "compressed_bytes_total",
+		Help:      "Number of message bytes after compression",
+	}, []string{"compression"})
+
+	uncompressedBytesCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gravity_adapter_mysql",
+		Name:      "uncompressed_bytes_total",
+		Help:      "Number of message bytes before compression",
+	}, []string{"compression"})
+)
+
+func observeCompression(c Compression, original int, compressed int) {
+
+	if original == 0 {
+		return
+	}
+
+	compressionRatio.WithLabelValues(string(c)).Observe(float64(compressed) / float64(original))
+	uncompressedBytesCounter.WithLabelValues(string(c)).Add(float64(original))
+	compressedBytesCounter.WithLabelValues(string(c)).Add(float64(compressed))
+}
+
+var gzipWriterPool = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(nil)
+	},
+}
+
+var zstdEncoder, _ = zstd.NewWriter(nil)
+
+func compress(c Compression, data []byte) ([]byte, error) {
+
+	switch c {
+	case S2Compression:
+		return s2.EncodeSnappyBetter(nil, data), nil
+	case ZstdCompression:
+		return zstdEncoder.EncodeAll(data, nil), nil
+	case GzipCompression:
+		var buf bytes.Buffer
+		w := gzipWriterPool.Get().(*gzip.Writer)
+		defer gzipWriterPool.Put(w)
+
+		w.Reset(&buf)
+		_, err := w.Write(data)
+		if err != nil {
+			return nil, err
+		}
+
+		err = w.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		return buf.Bytes(), nil
+	}
+
+	return data, nil
+}
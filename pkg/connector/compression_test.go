@@ -0,0 +1,172 @@
+package connector
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	gravity_adapter "github.com/BrobridgeOrg/gravity-sdk/v2/adapter"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+)
+
+// decode reads message data the way consumers do with Content-Encoding
+func decode(t *testing.T, encoding string, data []byte) []byte {
+
+	switch encoding {
+	case "":
+		return data
+	case "s2":
+		decoded, err := s2.Decode(nil, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return decoded
+	case "gzip":
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decoded, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return decoded
+	case "zstd":
+		d, err := zstd.NewReader(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer d.Close()
+
+		decoded, err := d.DecodeAll(data, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return decoded
+	}
+
+	t.Fatalf("unknown encoding %q", encoding)
+	return nil
+}
+
+func TestParseCompression(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		want  Compression
+		valid bool
+	}{
+		{"", NoCompression, true},
+		{"none", NoCompression, true},
+		{"s2", S2Compression, true},
+		{"gzip", GzipCompression, true},
+		{"zstd", ZstdCompression, true},
+		{"S2", NoCompression, false},
+		{"br", NoCompression, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseCompression(tt.name)
+			if (err == nil) != tt.valid {
+				t.Fatalf("ParseCompression(%q) = %v, want valid %v", tt.name, err, tt.valid)
+			}
+
+			if c != tt.want {
+				t.Fatalf("ParseCompression(%q) = %q, want %q", tt.name, c, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodedBy(t *testing.T) {
+
+	tests := []struct {
+		compression Compression
+		encodings   []string
+		want        bool
+	}{
+		{NoCompression, nil, true},
+		{S2Compression, DefaultConsumerEncodings, true},
+		{GzipCompression, DefaultConsumerEncodings, false},
+		{ZstdCompression, DefaultConsumerEncodings, false},
+		{ZstdCompression, []string{"s2", "zstd"}, true},
+		{S2Compression, []string{"gzip"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.compression), func(t *testing.T) {
+			if got := tt.compression.DecodedBy(tt.encodings); got != tt.want {
+				t.Fatalf("%s.DecodedBy(%v) = %v, want %v", tt.compression, tt.encodings, got, tt.want)
+			}
+		})
+	}
+}
+
+// Messages must be decoded the same way as consumers of gravity do
+func TestPrepareMsgRoundTrip(t *testing.T) {
+
+	payload := []byte(`{"id":1,"name":"` + string(bytes.Repeat([]byte("gravity"), 100)) + `"}`)
+
+	tests := []struct {
+		name        string
+		compression Compression
+		threshold   int
+		encoding    string
+	}{
+		{"none", NoCompression, 0, ""},
+		{"s2", S2Compression, 0, "s2"},
+		{"gzip", GzipCompression, 0, "gzip"},
+		{"zstd", ZstdCompression, 0, "zstd"},
+		{"below threshold", S2Compression, 1 << 20, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Publisher{
+				options: &Options{
+					Domain:               "default",
+					Compression:          tt.compression,
+					CompressionThreshold: tt.threshold,
+				},
+			}
+
+			m, err := p.prepareMsg("accountCreated", payload, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Pooled encoders must not leak data of the previous message
+			m, err = p.prepareMsg("accountCreated", payload, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if m.Subject != "$GVT.default.EVENT.accountCreated" {
+				t.Fatalf("unexpected subject %q", m.Subject)
+			}
+
+			if enc := m.Header.Get("Content-Encoding"); enc != tt.encoding {
+				t.Fatalf("Content-Encoding = %q, want %q", enc, tt.encoding)
+			}
+
+			data := decode(t, tt.encoding, m.Data)
+
+			var msg gravity_adapter.Message
+			err = json.Unmarshal(data, &msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if msg.EventName != "accountCreated" || !bytes.Equal(msg.Payload, payload) {
+				t.Fatalf("unexpected message %s", data)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package connector
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+
+	gravity_adapter "github.com/BrobridgeOrg/gravity-sdk/v2/adapter"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/nats-io/nats.go"
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+const (
+	domainEvent = "$GVT.%s.EVENT.%s"
+)
+
+type Options struct {
+	Domain      string
+	Compression Compression
+	// Messages smaller than CompressionThreshold bytes are sent uncompressed
+	CompressionThreshold   int
+	PublishAsyncMaxPending int
+}
+
+func NewOptions() *Options {
+	return &Options{
+		Domain:                 "default",
+		Compression:            NoCompression,
+		PublishAsyncMaxPending: 10240,
+	}
+}
+
+// Publisher publishes events in the same format as AdapterConnector of
+// gravity-sdk. AdapterConnector shares one JetStream context, so publisher has
+// its own to track pending acknowledgements separately from other publishers,
+// and they can be cleaned up without failing messages of others.
+type Publisher struct {
+	nc      *nats.Conn
+	js      nats.JetStreamContext
+	options *Options
+}
+
+// NewPublisher creates a publisher on connection to gravity
+func NewPublisher(conn *nats.Conn, options *Options) (*Publisher, error) {
+
+	js, err := conn.JetStream(nats.PublishAsyncMaxPending(options.PublishAsyncMaxPending))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Publisher{
+		nc:      conn,
+		js:      js,
+		options: options,
+	}, nil
+}
+
+func (p *Publisher) encode(eventName string, payload []byte) ([]byte, error) {
+	return json.Marshal(&gravity_adapter.Message{
+		EventName: eventName,
+		Payload:   payload,
+	})
+}
+
+// MessageSize returns size of message which carries payload with headers of
+// meta, server compares both against max_payload. Payload is encoded in base64
+// by the envelope so it is larger than payload itself. Compression is not
+// taken into account, so the message is never larger than that.
+func (p *Publisher) MessageSize(eventName string, payload []byte, meta map[string]string) (int, error) {
+
+	data, err := p.encode(eventName, payload)
+	if err != nil {
+		return 0, err
+	}
+
+	header := nats.Header{}
+	for k, v := range meta {
+		header.Add(k, v)
+	}
+
+	if p.compresses(data) {
+		header.Add("Content-Encoding", string(p.options.Compression))
+	}
+
+	return headerSize(header) + len(data), nil
+}
+
+// MaxPayload returns max_payload of server, 0 if it is not known yet
+func (p *Publisher) MaxPayload() int64 {
+	if p.nc == nil {
+		return 0
+	}
+
+	return p.nc.MaxPayload()
+}
+
+// headerSize returns size of header as it is sent to server
+func headerSize(header nats.Header) int {
+
+	if len(header) == 0 {
+		return 0
+	}
+
+	var b bytes.Buffer
+	b.WriteString("NATS/1.0\r\n")
+	http.Header(header).Write(&b)
+	b.WriteString("\r\n")
+
+	return b.Len()
+}
+
+func (p *Publisher) compresses(data []byte) bool {
+	return p.options.Compression != NoCompression && len(data) >= p.options.CompressionThreshold
+}
+
+func (p *Publisher) prepareMsg(eventName string, payload []byte, meta map[string]string) (*nats.Msg, error) {
+
+	data, err := p.encode(eventName, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &nats.Msg{
+		Subject: fmt.Sprintf(domainEvent, p.options.Domain, eventName),
+		Header:  nats.Header{},
+	}
+
+	for k, v := range meta {
+		m.Header.Add(k, v)
+	}
+
+	m.Data = data
+
+	if p.compresses(data) {
+		compressed, err := compress(p.options.Compression, data)
+		if err != nil {
+			return nil, err
+		}
+
+		m.Header.Add("Content-Encoding", string(p.options.Compression))
+		m.Data = compressed
+
+		observeCompression(p.options.Compression, len(data), len(compressed))
+	}
+
+	return m, nil
+}
+
+func (p *Publisher) PublishAsync(eventName string, payload []byte, meta map[string]string) (nats.PubAckFuture, error) {
+
+	m, err := p.prepareMsg(eventName, payload, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.js.PublishMsgAsync(m)
+}
+
+// PublishMsg sends a prepared message again and waits for acknowledgement
+func (p *Publisher) PublishMsg(m *nats.Msg) (*nats.PubAck, error) {
+	return p.js.PublishMsg(m)
+}
+
+// CleanupPublisher fails all pending acknowledgements of publisher
+func (p *Publisher) CleanupPublisher() {
+	p.js.CleanupPublisher()
+}
+
+// ObjectStore returns bucket of object store, it is created with config if it
+// does not exist. Existing bucket keeps its own config.
+func (p *Publisher) ObjectStore(config *nats.ObjectStoreConfig) (nats.ObjectStore, error) {
+
+	obs, err := p.js.ObjectStore(config.Bucket)
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		return p.js.CreateObjectStore(config)
+	}
+
+	return obs, err
+}
@@ -0,0 +1,63 @@
+package connector
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Server compares headers and data against max_payload
+func TestMessageSize(t *testing.T) {
+
+	payload := []byte(`{"id":1,"name":"` + string(bytes.Repeat([]byte("gravity"), 100)) + `"}`)
+
+	tests := []struct {
+		name        string
+		compression Compression
+		meta        map[string]string
+	}{
+		{"no headers", NoCompression, nil},
+		{"message id", NoCompression, map[string]string{"Nats-Msg-Id": "mysql-accounts-mysql-bin.000001-120-0"}},
+		{"partial row", NoCompression, map[string]string{"Nats-Msg-Id": "mysql-accounts-1", "Gravity-Partial-Row": "true"}},
+		{"compressed", S2Compression, map[string]string{"Nats-Msg-Id": "mysql-accounts-1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Publisher{
+				options: &Options{
+					Domain:      "default",
+					Compression: tt.compression,
+				},
+			}
+
+			size, err := p.MessageSize("accountCreated", payload, tt.meta)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			m, err := p.prepareMsg("accountCreated", payload, tt.meta)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Size of message without subject is what server counts
+			sent := m.Size() - len(m.Subject)
+			if tt.compression == NoCompression && size != sent {
+				t.Fatalf("size = %d, want %d", size, sent)
+			}
+
+			if size < sent {
+				t.Fatalf("size = %d, smaller than message of %d bytes", size, sent)
+			}
+
+			data, err := p.encode("accountCreated", payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(tt.meta) > 0 && size <= len(data) {
+				t.Fatalf("size = %d, headers were not counted", size)
+			}
+		})
+	}
+}